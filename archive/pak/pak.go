@@ -13,9 +13,13 @@ import (
 	"encoding/binary"
 	"errors"
 	"io"
+	"io/fs"
 	"io/ioutil"
 	"os"
 	"path"
+	"sort"
+	"strings"
+	"time"
 )
 
 type File struct {
@@ -138,3 +142,132 @@ func (rc *Reader) init(r io.ReaderAt, size int64) error {
 
 	return nil
 }
+
+// Open opens the named file for reading, making Reader an fs.FS. Names are
+// matched the same way they are stored, in lower case. Directories are made
+// up of the paths of files, "." being the root of the archive.
+func (rc *Reader) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+
+	lower := strings.ToLower(name)
+	for _, f := range rc.File {
+		if f.Name == lower {
+			return &file{
+				SectionReader: io.NewSectionReader(f.r, int64(f.offset), int64(f.Size)),
+				f:             f,
+			}, nil
+		}
+	}
+
+	if d := rc.dir(lower); d != nil {
+		return d, nil
+	}
+
+	return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+}
+
+// dir lists a directory, nil if there are no files in it.
+func (rc *Reader) dir(name string) *dir {
+	prefix := name + "/"
+	if name == "." {
+		prefix = ""
+	}
+
+	seen := make(map[string]bool)
+	d := &dir{name: name}
+	for _, f := range rc.File {
+		if !strings.HasPrefix(f.Name, prefix) || !fs.ValidPath(f.Name) || f.Name == "." {
+			continue
+		}
+
+		child := f.Name[len(prefix):]
+		var info fs.FileInfo = fileInfo{f}
+		if i := strings.IndexByte(child, '/'); i >= 0 {
+			child = child[:i]
+			info = dirInfo{child}
+		}
+
+		if !seen[child] {
+			seen[child] = true
+			d.entries = append(d.entries, fs.FileInfoToDirEntry(info))
+		}
+	}
+
+	if len(d.entries) == 0 && name != "." {
+		return nil
+	}
+
+	sort.Slice(d.entries, func(i, j int) bool {
+		return d.entries[i].Name() < d.entries[j].Name()
+	})
+
+	return d
+}
+
+// dir is a directory opened through the fs.FS interface.
+type dir struct {
+	name    string
+	entries []fs.DirEntry
+}
+
+func (d *dir) Stat() (fs.FileInfo, error) {
+	return dirInfo{path.Base(d.name)}, nil
+}
+
+func (d *dir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.name, Err: errors.New("is a directory")}
+}
+
+func (d *dir) Close() error {
+	return nil
+}
+
+func (d *dir) ReadDir(n int) (entries []fs.DirEntry, err error) {
+	if n > 0 && len(d.entries) == 0 {
+		err = io.EOF
+		return
+	} else if n <= 0 || n > len(d.entries) {
+		n = len(d.entries)
+	}
+
+	entries, d.entries = d.entries[:n], d.entries[n:]
+	return
+}
+
+type dirInfo struct {
+	name string
+}
+
+func (di dirInfo) Name() string       { return di.name }
+func (di dirInfo) Size() int64        { return 0 }
+func (di dirInfo) Mode() fs.FileMode  { return fs.ModeDir | 0555 }
+func (di dirInfo) ModTime() time.Time { return time.Time{} }
+func (di dirInfo) IsDir() bool        { return true }
+func (di dirInfo) Sys() interface{}   { return nil }
+
+// file is a File opened through the fs.FS interface.
+type file struct {
+	*io.SectionReader
+	f *File
+}
+
+func (f *file) Stat() (fs.FileInfo, error) {
+	return fileInfo{f.f}, nil
+}
+
+func (f *file) Close() error {
+	return nil
+}
+
+type fileInfo struct {
+	f *File
+}
+
+func (fi fileInfo) Name() string       { return path.Base(fi.f.Name) }
+func (fi fileInfo) Size() int64        { return int64(fi.f.Size) }
+func (fi fileInfo) Mode() fs.FileMode  { return 0444 }
+func (fi fileInfo) ModTime() time.Time { return time.Time{} }
+func (fi fileInfo) IsDir() bool        { return false }
+func (fi fileInfo) Sys() interface{}   { return fi.f }
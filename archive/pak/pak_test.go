@@ -0,0 +1,101 @@
+package pak
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/fs"
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+// pakData builds an archive out of names and contents.
+func pakData(files ...string) []byte {
+	var data, dir bytes.Buffer
+
+	for i := 0; i+1 < len(files); i += 2 {
+		var entry [pakEntrySize]byte
+		copy(entry[:56], files[i])
+		binary.LittleEndian.PutUint32(entry[56:], uint32(12+data.Len()))
+		binary.LittleEndian.PutUint32(entry[60:], uint32(len(files[i+1])))
+		dir.Write(entry[:])
+		data.WriteString(files[i+1])
+	}
+
+	b := []byte("PACK")
+	b = binary.LittleEndian.AppendUint32(b, uint32(12+data.Len()))
+	b = binary.LittleEndian.AppendUint32(b, uint32(dir.Len()))
+	b = append(b, data.Bytes()...)
+	return append(b, dir.Bytes()...)
+}
+
+func testReader(t *testing.T) *Reader {
+	b := pakData(
+		"maps/e1m1.bsp", "bsp",
+		"gfx/palette.lmp", "palette",
+		"Progs/Player.mdl", "player",
+		"scripts/base.shader", "base",
+		"scripts/sky.shader", "sky",
+		"default.cfg", "bind",
+	)
+
+	rc, err := NewReader(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return rc
+}
+
+func TestReader(t *testing.T) {
+	rc := testReader(t)
+	if len(rc.File) != 6 || rc.File[2].Name != "progs/player.mdl" || rc.File[2].Size != 6 {
+		t.Fatalf("bad files %+v", rc.File)
+	}
+
+	r, err := rc.File[1].Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if b, err := io.ReadAll(r); err != nil || string(b) != "palette" {
+		t.Fatalf("read %q (%v)", b, err)
+	}
+
+	if _, err = NewReader(bytes.NewReader(make([]byte, 12)), 12); err != ErrFormat {
+		t.Fatalf("got %v, want ErrFormat", err)
+	}
+}
+
+func TestFS(t *testing.T) {
+	rc := testReader(t)
+
+	if err := fstest.TestFS(rc, "maps/e1m1.bsp", "gfx/palette.lmp", "progs/player.mdl", "scripts/sky.shader", "default.cfg"); err != nil {
+		t.Fatal(err)
+	}
+
+	if b, err := fs.ReadFile(rc, "Progs/Player.MDL"); err != nil || string(b) != "player" {
+		t.Fatalf("read %q (%v)", b, err)
+	}
+
+	names, err := fs.Glob(rc, "scripts/*.shader")
+	if err != nil || !reflect.DeepEqual(names, []string{"scripts/base.shader", "scripts/sky.shader"}) {
+		t.Fatalf("glob %v (%v)", names, err)
+	}
+
+	var walked []string
+	err = fs.WalkDir(rc, ".", func(name string, d fs.DirEntry, err error) error {
+		walked = append(walked, name)
+		return err
+	})
+	want := []string{".", "default.cfg", "gfx", "gfx/palette.lmp", "maps", "maps/e1m1.bsp", "progs", "progs/player.mdl", "scripts", "scripts/base.shader", "scripts/sky.shader"}
+	if err != nil || !reflect.DeepEqual(walked, want) {
+		t.Fatalf("walked %v (%v)", walked, err)
+	}
+
+	if _, err = rc.Open("sound"); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("got %v, want fs.ErrNotExist", err)
+	}
+}
@@ -0,0 +1,213 @@
+/*
+Package atlas packs many small images into a few big ones.
+
+Pages are RGBA images with power of two sides. Images are placed on shelves
+(rows) sorted by height, which is good enough for textures that mostly have
+power of two sizes themselves.
+*/
+package atlas
+
+import (
+	"errors"
+	"image"
+	"image/draw"
+	"sort"
+)
+
+var (
+	ErrTooLarge = errors.New("atlas: image does not fit into a page")
+)
+
+// DefaultMaxSize is the page size limit used when Options.MaxSize is zero.
+const DefaultMaxSize = 2048
+
+type Options struct {
+	MaxSize int  // maximum width and height of a page, rounded down to a power of two
+	Padding int  // pixels left around every image
+	Bleed   bool // fill padding with the edge pixels of images
+}
+
+// Entry tells where an image was put.
+type Entry struct {
+	Page int             // page index, -1 for images not packed
+	Rect image.Rectangle // pixels of the image on the page, padding excluded
+	Min  [2]float64      // texture coordinates of the top left corner
+	Max  [2]float64      // texture coordinates of the bottom right corner
+}
+
+type Atlas struct {
+	Pages   []*image.RGBA
+	Entries []Entry // one for every image given to Pack
+}
+
+type shelf struct {
+	y, h, x int
+}
+
+type page struct {
+	shelves []shelf
+	w, h    int // used area
+}
+
+// Pack puts images into pages. Nil images are skipped, their entries have
+// Page set to -1. The result only depends on the images and options given.
+//
+// Texture coordinates of entries only cover the image once: callers wrapping
+// textures around faces have to do so within the entry rectangle.
+func Pack(images []image.Image, o *Options) (a *Atlas, err error) {
+	var opt Options
+	if o != nil {
+		opt = *o
+	}
+	if opt.MaxSize <= 0 {
+		opt.MaxSize = DefaultMaxSize
+	} else if n := pow2(opt.MaxSize); n != opt.MaxSize {
+		opt.MaxSize = n / 2
+	}
+
+	order := make([]int, 0, len(images))
+	for i, m := range images {
+		if m != nil {
+			order = append(order, i)
+		}
+	}
+
+	sort.SliceStable(order, func(i, j int) bool {
+		a, b := images[order[i]].Bounds().Size(), images[order[j]].Bounds().Size()
+		if a.Y != b.Y {
+			return a.Y > b.Y
+		}
+		return a.X > b.X
+	})
+
+	a = &Atlas{
+		Entries: make([]Entry, len(images)),
+	}
+	for i := range a.Entries {
+		a.Entries[i].Page = -1
+	}
+
+	var pages []*page
+	pos := make([]image.Point, len(images))
+
+	for _, i := range order {
+		size := images[i].Bounds().Size().Add(image.Pt(2*opt.Padding, 2*opt.Padding))
+		if size.X > opt.MaxSize || size.Y > opt.MaxSize {
+			return nil, ErrTooLarge
+		}
+
+		placed := false
+		for pi, p := range pages {
+			if pt, ok := p.place(size, opt.MaxSize); ok {
+				a.Entries[i].Page = pi
+				pos[i] = pt
+				placed = true
+				break
+			}
+		}
+
+		if !placed {
+			p := new(page)
+			pos[i], _ = p.place(size, opt.MaxSize)
+			a.Entries[i].Page = len(pages)
+			pages = append(pages, p)
+		}
+	}
+
+	for _, p := range pages {
+		a.Pages = append(a.Pages, image.NewRGBA(image.Rect(0, 0, pow2(p.w), pow2(p.h))))
+	}
+
+	for _, i := range order {
+		e := &a.Entries[i]
+		dst := a.Pages[e.Page]
+		src := images[i]
+		sr := src.Bounds()
+		min := pos[i].Add(image.Pt(opt.Padding, opt.Padding))
+
+		e.Rect = image.Rectangle{min, min.Add(sr.Size())}
+		draw.Draw(dst, e.Rect, src, sr.Min, draw.Src)
+
+		if opt.Bleed && opt.Padding > 0 {
+			bleed(dst, e.Rect, opt.Padding)
+		}
+
+		size := dst.Rect.Size()
+		e.Min = [2]float64{float64(e.Rect.Min.X) / float64(size.X), float64(e.Rect.Min.Y) / float64(size.Y)}
+		e.Max = [2]float64{float64(e.Rect.Max.X) / float64(size.X), float64(e.Rect.Max.Y) / float64(size.Y)}
+	}
+
+	return
+}
+
+// place finds room for an image of the given size (padding included).
+func (p *page) place(size image.Point, max int) (pt image.Point, ok bool) {
+	for i := range p.shelves {
+		s := &p.shelves[i]
+		if size.Y <= s.h && s.x+size.X <= max {
+			pt = image.Pt(s.x, s.y)
+			s.x += size.X
+			p.grow(s.x, s.y+size.Y)
+			return pt, true
+		}
+	}
+
+	y := 0
+	if n := len(p.shelves); n > 0 {
+		y = p.shelves[n-1].y + p.shelves[n-1].h
+	}
+
+	if y+size.Y > max {
+		return
+	}
+
+	p.shelves = append(p.shelves, shelf{y: y, h: size.Y, x: size.X})
+	p.grow(size.X, y+size.Y)
+
+	return image.Pt(0, y), true
+}
+
+func (p *page) grow(w, h int) {
+	if w > p.w {
+		p.w = w
+	}
+	if h > p.h {
+		p.h = h
+	}
+}
+
+// bleed fills the padding around r with the nearest pixels of r.
+func bleed(m *image.RGBA, r image.Rectangle, padding int) {
+	outer := r.Inset(-padding).Intersect(m.Rect)
+
+	for y := outer.Min.Y; y < outer.Max.Y; y++ {
+		sy := clamp(y, r.Min.Y, r.Max.Y-1)
+		for x := outer.Min.X; x < outer.Max.X; x++ {
+			if (image.Point{x, y}).In(r) {
+				continue
+			}
+
+			sx := clamp(x, r.Min.X, r.Max.X-1)
+			m.SetRGBA(x, y, m.RGBAAt(sx, sy))
+		}
+	}
+}
+
+func clamp(v, min, max int) int {
+	if v < min {
+		return min
+	} else if v > max {
+		return max
+	}
+
+	return v
+}
+
+func pow2(v int) int {
+	n := 1
+	for n < v {
+		n <<= 1
+	}
+
+	return n
+}
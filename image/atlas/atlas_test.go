@@ -0,0 +1,94 @@
+package atlas
+
+import (
+	"image"
+	"image/color"
+	"reflect"
+	"testing"
+)
+
+func solid(w, h int, c uint8) image.Image {
+	m := image.NewGray(image.Rect(0, 0, w, h))
+	for i := range m.Pix {
+		m.Pix[i] = c
+	}
+
+	return m
+}
+
+func TestPack(t *testing.T) {
+	images := []image.Image{
+		solid(16, 16, 1),
+		nil,
+		solid(32, 8, 2),
+		solid(64, 64, 3),
+		solid(16, 32, 4),
+	}
+
+	// 64x64 with padding doesn't fit a 64x64 page
+	if _, err := Pack(images, &Options{MaxSize: 64, Padding: 1}); err != ErrTooLarge {
+		t.Fatalf("got %v, want ErrTooLarge", err)
+	}
+
+	a, err := Pack(images, &Options{MaxSize: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// max size is rounded down to 64, the biggest image gets its own page
+	if len(a.Pages) != 2 || a.Pages[0].Rect.Size() != image.Pt(64, 64) || a.Pages[1].Rect.Size() != image.Pt(64, 32) {
+		t.Fatalf("unexpected pages %v", a.Pages)
+	}
+}
+
+func TestPackPages(t *testing.T) {
+	images := []image.Image{
+		solid(16, 16, 1),
+		nil,
+		solid(32, 8, 2),
+		solid(62, 62, 3),
+		solid(16, 30, 4),
+	}
+
+	a, err := Pack(images, &Options{MaxSize: 64, Padding: 1, Bleed: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(a.Pages) != 2 || a.Pages[0].Rect.Size() != image.Pt(64, 64) || a.Pages[1].Rect.Size() != image.Pt(64, 64) {
+		t.Fatalf("unexpected pages %d", len(a.Pages))
+	}
+
+	if a.Entries[1].Page != -1 {
+		t.Error("nil image packed")
+	}
+
+	for i, m := range images {
+		if m == nil {
+			continue
+		}
+
+		e := a.Entries[i]
+		p := a.Pages[e.Page]
+		if e.Rect.Size() != m.Bounds().Size() {
+			t.Errorf("%d: rect %v", i, e.Rect)
+		}
+
+		want := color.RGBAModel.Convert(m.At(0, 0))
+		for _, pt := range []image.Point{e.Rect.Min, e.Rect.Max.Sub(image.Pt(1, 1)), e.Rect.Min.Sub(image.Pt(1, 1)), e.Rect.Max} {
+			if got := p.At(pt.X, pt.Y); got != want {
+				t.Errorf("%d: got %v at %v, want %v", i, got, pt, want)
+			}
+		}
+
+		size := p.Rect.Size()
+		if e.Min[0]*float64(size.X) != float64(e.Rect.Min.X) || e.Max[1]*float64(size.Y) != float64(e.Rect.Max.Y) {
+			t.Errorf("%d: uv %v %v for %v", i, e.Min, e.Max, e.Rect)
+		}
+	}
+
+	b, _ := Pack(images, &Options{MaxSize: 64, Padding: 1, Bleed: true})
+	if !reflect.DeepEqual(a, b) {
+		t.Error("packing is not deterministic")
+	}
+}
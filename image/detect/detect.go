@@ -0,0 +1,248 @@
+/*
+Package detect guesses the format of Quake family images.
+
+LMP, WAL and Half-Life textures have no magic numbers, so the image package
+can not tell them apart. Sniff scores a prefix of the data (and, when known,
+the file name and size) against the structure of each format instead.
+*/
+package detect
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"github.com/ftrvxmtrx/groke/image/hltex"
+	"github.com/ftrvxmtrx/groke/image/lmp"
+	"github.com/ftrvxmtrx/groke/image/pcx"
+	"github.com/ftrvxmtrx/groke/image/wal"
+	"image"
+	"io"
+	"path"
+	"strings"
+)
+
+// PrefixLen is the number of leading bytes Sniff needs to see.
+const PrefixLen = 128
+
+// Format describes an image format known to the package.
+type Format struct {
+	Name         string
+	Decode       func(io.Reader) (image.Image, error)
+	DecodeConfig func(io.Reader) (image.Config, error)
+	score        func(b []byte, name string, size int64) int
+}
+
+// Formats lists all formats Sniff chooses from.
+var Formats = []*Format{
+	{"lmp", lmp.Decode, lmp.DecodeConfig, scoreLMP},
+	{"wal", wal.Decode, wal.DecodeConfig, scoreWAL},
+	{"hltex", hltex.Decode, hltex.DecodeConfig, scoreHLTex},
+	{"pcx", pcx.Decode, pcx.DecodeConfig, scorePCX},
+}
+
+var (
+	ErrFormat = errors.New("detect: unknown format")
+)
+
+// Sniff returns the format most likely to be stored in data starting with
+// prefix, along with its score. The name and total size of the data may be
+// left empty and negative if they are not known. A nil format is returned
+// if none of them fits.
+func Sniff(prefix []byte, name string, size int64) (f *Format, score int) {
+	for _, ff := range Formats {
+		if s := ff.score(prefix, name, size); s > score {
+			f = ff
+			score = s
+		}
+	}
+
+	return
+}
+
+// Decode decodes an image in any of the known formats, falling back to
+// image.Decode for the ones registered with a magic string. The string
+// returned is the format name.
+func Decode(r io.Reader, name string, size int64) (m image.Image, format string, err error) {
+	prefix := make([]byte, PrefixLen)
+	n, err := io.ReadFull(r, prefix)
+	if err == io.ErrUnexpectedEOF || err == io.EOF {
+		err = nil
+	} else if err != nil {
+		return
+	}
+	prefix = prefix[:n]
+	r = io.MultiReader(bytes.NewReader(prefix), r)
+
+	if f, _ := Sniff(prefix, name, size); f != nil {
+		m, err = f.Decode(r)
+		format = f.Name
+		return
+	}
+
+	m, format, err = image.Decode(r)
+	if err == image.ErrFormat {
+		err = ErrFormat
+	}
+
+	// image.Decode may have picked one of the formats registered without
+	// magic, which Sniff has already ruled out
+	for _, f := range Formats {
+		if f.Name == format {
+			m, format, err = nil, "", ErrFormat
+			break
+		}
+	}
+
+	return
+}
+
+func ext(name string) string {
+	return strings.ToLower(path.Ext(name))
+}
+
+func base(name string) string {
+	name = strings.ToLower(path.Base(name))
+	return strings.TrimSuffix(name, path.Ext(name))
+}
+
+// validName checks a NUL padded name field.
+func validName(b []byte) bool {
+	n := bytes.IndexByte(b, 0)
+	if n == 0 {
+		return false
+	} else if n < 0 {
+		n = len(b)
+	}
+
+	for _, c := range b[:n] {
+		if c < 0x20 || c >= 0x7f {
+			return false
+		}
+	}
+
+	return true
+}
+
+// mipOffsets checks offsets of four mip levels following a header of the
+// given length.
+func mipOffsets(b []byte, headerLen, w, h int) bool {
+	off := headerLen
+	for i := 0; i < 4; i++ {
+		if int(binary.LittleEndian.Uint32(b[4*i:])) != off {
+			return false
+		}
+		off += (w >> uint(i)) * (h >> uint(i))
+	}
+
+	return true
+}
+
+func mipSize(w, h int) int64 {
+	return int64(w*h + w*h/4 + w*h/16 + w*h/64)
+}
+
+func scoreLMP(b []byte, name string, size int64) (score int) {
+	if len(b) < 8 {
+		return
+	}
+
+	if ext(name) == ".lmp" {
+		score += 20
+	}
+
+	if size == 128*128 && base(name) == "conchars" {
+		return score + 80
+	}
+
+	w := int(binary.LittleEndian.Uint32(b))
+	h := int(binary.LittleEndian.Uint32(b[4:]))
+	if w <= 0 || h <= 0 || w > 4096 || h > 4096 {
+		return 0
+	}
+
+	if size >= 0 {
+		if size != int64(8+w*h) {
+			return 0
+		}
+		score += 50
+	}
+
+	return score + 10
+}
+
+func scoreWAL(b []byte, name string, size int64) (score int) {
+	if len(b) < 56 || !validName(b[:32]) {
+		return
+	}
+
+	w := int(binary.LittleEndian.Uint32(b[32:]))
+	h := int(binary.LittleEndian.Uint32(b[36:]))
+	if w <= 0 || h <= 0 || w > 4096 || h > 4096 || !mipOffsets(b[40:], 100, w, h) {
+		return
+	}
+
+	if size >= 0 {
+		if size < 100+mipSize(w, h) {
+			return 0
+		} else if size == 100+mipSize(w, h) {
+			score += 20
+		}
+	}
+
+	if ext(name) == ".wal" {
+		score += 20
+	}
+
+	return score + 60
+}
+
+func scoreHLTex(b []byte, name string, size int64) (score int) {
+	if len(b) < 40 || !validName(b[:16]) {
+		return
+	}
+
+	w := int(binary.LittleEndian.Uint32(b[16:]))
+	h := int(binary.LittleEndian.Uint32(b[20:]))
+	if w <= 0 || h <= 0 || w > 4096 || h > 4096 || w%16 != 0 || h%16 != 0 {
+		return
+	}
+
+	if !mipOffsets(b[24:], 40, w, h) {
+		return
+	}
+
+	if size >= 0 {
+		// mips, palette size and palette, optionally padded to 4 bytes
+		pal := 40 + mipSize(w, h) + 2 + 256*3
+		if size != pal && size != pal+2 {
+			return 0
+		}
+		score += 20
+	}
+
+	return score + 60
+}
+
+func scorePCX(b []byte, name string, size int64) (score int) {
+	if len(b) < 128 || b[0] != 0x0a || b[1] > 5 || b[2] != 1 || b[3] != 8 || b[65] != 1 {
+		return
+	}
+
+	xmin := binary.LittleEndian.Uint16(b[4:])
+	ymin := binary.LittleEndian.Uint16(b[6:])
+	xmax := binary.LittleEndian.Uint16(b[8:])
+	ymax := binary.LittleEndian.Uint16(b[10:])
+	if xmin > xmax || ymin > ymax {
+		return
+	}
+
+	if size >= 0 && size < 128+769 {
+		return
+	}
+
+	if ext(name) == ".pcx" {
+		score += 20
+	}
+
+	return score + 70
+}
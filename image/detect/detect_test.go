@@ -0,0 +1,99 @@
+package detect
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/ftrvxmtrx/groke/image/hltex"
+	"image"
+	"image/color"
+	"testing"
+)
+
+func put32(b []byte, v ...int) {
+	for i, x := range v {
+		binary.LittleEndian.PutUint32(b[i*4:], uint32(x))
+	}
+}
+
+func lmpData(w, h int) []byte {
+	b := make([]byte, 8+w*h)
+	put32(b, w, h)
+	return b
+}
+
+func walData(w, h int) []byte {
+	b := make([]byte, 100+mipSize(w, h))
+	copy(b, "e1u1/floor1_1")
+	put32(b[32:], w, h, 100, 100+w*h, 100+w*h+w*h/4, 100+w*h+w*h/4+w*h/16)
+	return b
+}
+
+func hltexData(w, h int) []byte {
+	b := make([]byte, 40+mipSize(w, h)+2+768+2)
+	copy(b, "brick")
+	put32(b[16:], w, h, 40, 40+w*h, 40+w*h+w*h/4, 40+w*h+w*h/4+w*h/16)
+	binary.LittleEndian.PutUint16(b[40+mipSize(w, h):], 256)
+	return b
+}
+
+func TestSniff(t *testing.T) {
+	for _, c := range []struct {
+		data []byte
+		name string
+		want string
+	}{
+		{lmpData(24, 24), "gfx/face1.lmp", "lmp"},
+		{lmpData(24, 24), "", "lmp"},
+		{make([]byte, 128*128), "conchars", "lmp"},
+		{walData(64, 32), "textures/e1u1/floor1_1.wal", "wal"},
+		{walData(64, 32), "", "wal"},
+		{hltexData(32, 16), "brick", "hltex"},
+		{make([]byte, 300), "", ""},
+	} {
+		size := int64(len(c.data))
+		prefix := c.data
+		if len(prefix) > PrefixLen {
+			prefix = prefix[:PrefixLen]
+		}
+
+		f, _ := Sniff(prefix, c.name, size)
+		if got := ""; f != nil {
+			got = f.Name
+			if got != c.want {
+				t.Errorf("%q (%d bytes): got %s, want %s", c.name, size, got, c.want)
+			}
+		} else if c.want != "" {
+			t.Errorf("%q (%d bytes): not detected, want %s", c.name, size, c.want)
+		}
+	}
+}
+
+func TestDecode(t *testing.T) {
+	b := walData(16, 8)
+	m, format, err := Decode(bytes.NewReader(b), "", int64(len(b)))
+	if err != nil {
+		t.Fatal(err)
+	} else if format != "wal" {
+		t.Fatalf("format %s", format)
+	} else if r := m.Bounds(); r.Dx() != 16 || r.Dy() != 8 {
+		t.Fatalf("bounds %v", r)
+	}
+
+	// Half-Life textures are longer than the sniffed prefix
+	b = hltexData(32, 16)
+	pal := 40 + mipSize(32, 16) + 2
+	copy(b[pal+3:], []byte{10, 20, 30})
+	if m, format, err = Decode(bytes.NewReader(b), "brick", int64(len(b))); err != nil {
+		t.Fatal(err)
+	} else if format != "hltex" {
+		t.Fatalf("format %s", format)
+	} else if r := m.Bounds(); r.Dx() != 32 || r.Dy() != 16 {
+		t.Fatalf("bounds %v", r)
+	} else if c := m.(*hltex.HLTex).Image.(*image.Paletted).Palette[1]; c != (color.NRGBA{10, 20, 30, 0xff}) {
+		t.Fatalf("palette %v", c)
+	}
+
+	if _, _, err = Decode(bytes.NewReader(make([]byte, 10)), "", 10); err != ErrFormat {
+		t.Fatalf("got %v, want ErrFormat", err)
+	}
+}
@@ -62,11 +62,16 @@ func Decode(r io.Reader) (outImage image.Image, err error) {
 	dataOff -= len(b)
 	palOff -= len(b)
 
+	// the palette may be shorter than 256 colours
 	var size int
 	b = make([]byte, palOff+2+256*3)
-	if size, err = r.Read(b); err != nil {
+	if size, err = io.ReadFull(r, b); err == io.ErrUnexpectedEOF || err == io.EOF {
+		err = nil
+	} else if err != nil {
 		return
-	} else if size < palOff+2 {
+	}
+
+	if size < palOff+2 {
 		err = ErrFormat
 		return
 	}
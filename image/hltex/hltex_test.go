@@ -4,6 +4,7 @@ import (
 	"github.com/ftrvxmtrx/groke/archive/wad"
 	"github.com/ftrvxmtrx/tga"
 	"image"
+	"image/color"
 	"log"
 	"os"
 	"strings"
@@ -69,3 +70,26 @@ func TestHLTex(t *testing.T) {
 
 	group.Wait()
 }
+
+func TestRemapSkin(t *testing.T) {
+	p := make(color.Palette, 256)
+	for i := range p {
+		p[i] = color.NRGBA{0xff, 0x80, 0x80, 0xff}
+	}
+
+	m := &image.Paletted{Pix: []uint8{0, TopLow}, Stride: 2, Rect: image.Rect(0, 0, 2, 1), Palette: p}
+	out := RemapSkin(m, 170, 0)
+
+	if out.Palette[0] != p[0] {
+		t.Error("colour outside of remap range changed")
+	}
+
+	// 170 is a hue of 240 degrees, pure blue
+	if c := out.Palette[TopLow].(color.NRGBA); c.B != 0xff || c.R != c.G || c.R >= c.B {
+		t.Errorf("unexpected top colour %v", c)
+	}
+
+	if p[TopLow] != out.Palette[0] {
+		t.Error("source palette modified")
+	}
+}
@@ -0,0 +1,97 @@
+package hltex
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"strings"
+)
+
+// Palette ranges recoloured on Half-Life player model skins.
+const (
+	TopLow     = 160
+	TopHigh    = 191
+	BottomLow  = 192
+	BottomHigh = 223
+)
+
+// IsRemap reports whether a studio model texture with the given name is
+// recoloured with player colours.
+func IsRemap(name string) bool {
+	name = strings.ToLower(name)
+	return strings.HasPrefix(name, "dm_base") || strings.HasPrefix(name, "remap")
+}
+
+// RemapSkin returns a copy of m with a new palette having the top and bottom
+// ranges hue-shifted to topcolor and bottomcolor (0-255, as in the
+// "topcolor"/"bottomcolor" userinfo keys). Pixels are shared with m.
+func RemapSkin(m *image.Paletted, topcolor, bottomcolor int) *image.Paletted {
+	p := make(color.Palette, len(m.Palette))
+	copy(p, m.Palette)
+
+	HueReplace(p, topcolor, TopLow, TopHigh)
+	HueReplace(p, bottomcolor, BottomLow, BottomHigh)
+
+	return &image.Paletted{
+		Pix:     m.Pix,
+		Stride:  m.Stride,
+		Rect:    m.Rect,
+		Palette: p,
+	}
+}
+
+// HueReplace replaces the hue of palette entries start..end (inclusive) with
+// newHue (0-255), keeping their saturation and value.
+func HueReplace(p color.Palette, newHue, start, end int) {
+	hue := float64(newHue) * (360.0 / 255)
+
+	for i := start; i <= end && i < len(p); i++ {
+		c := color.NRGBAModel.Convert(p[i]).(color.NRGBA)
+		r, g, b := float64(c.R), float64(c.G), float64(c.B)
+
+		maxcol := math.Max(math.Max(r, g), b) / 255
+		mincol := math.Min(math.Min(r, g), b) / 255
+		if maxcol == 0 {
+			continue
+		}
+
+		val := maxcol
+		sat := (maxcol - mincol) / maxcol
+		mincol = val * (1 - sat)
+
+		switch {
+		case hue <= 120:
+			b = mincol
+			if hue < 60 {
+				r = val
+				g = mincol + hue*(val-mincol)/(120-hue)
+			} else {
+				g = val
+				r = mincol + (120-hue)*(val-mincol)/hue
+			}
+		case hue <= 240:
+			r = mincol
+			if hue < 180 {
+				g = val
+				b = mincol + (hue-120)*(val-mincol)/(240-hue)
+			} else {
+				b = val
+				g = mincol + (240-hue)*(val-mincol)/(hue-120)
+			}
+		default:
+			g = mincol
+			if hue < 300 {
+				b = val
+				r = mincol + (hue-240)*(val-mincol)/(360-hue)
+			} else {
+				r = val
+				b = mincol + (360-hue)*(val-mincol)/(hue-240)
+			}
+		}
+
+		c.R = uint8(r * 255)
+		c.G = uint8(g * 255)
+		c.B = uint8(b * 255)
+		p[i] = c
+	}
+}
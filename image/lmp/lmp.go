@@ -5,12 +5,12 @@ WADs).
 package lmp
 
 import (
-	"bytes"
 	"encoding/binary"
 	"errors"
 	"image"
 	"image/color"
 	"io"
+	"io/fs"
 )
 
 var Palette color.Palette
@@ -37,13 +37,40 @@ func Decode(r io.Reader) (outImage image.Image, err error) {
 }
 
 // DecodeConfig decodes a header of LMP image and returns its
-// configuration.
+// configuration. Only the header is read. Telling conchars, which has no
+// header, from an image with one takes the size of the data, known when r
+// has a Len (bytes.Reader, strings.Reader) or Stat (fs.File) method. For
+// other readers 16384 byte conchars starting with something looking like a
+// header is reported with the size in that header, while Decode reads it as
+// conchars.
 func DecodeConfig(r io.Reader) (cfg image.Config, err error) {
-	if w, h, _, loadErr := load(r); loadErr == nil {
-		cfg.Width = w
-		cfg.Height = h
-	} else {
-		err = loadErr
+	size := int64(-1)
+	switch s := r.(type) {
+	case interface{ Len() int }:
+		size = int64(s.Len())
+	case interface{ Stat() (fs.FileInfo, error) }:
+		if fi, statErr := s.Stat(); statErr == nil {
+			size = fi.Size()
+		}
+	}
+
+	var b [8]byte
+
+	if _, err = io.ReadFull(r, b[:]); err != nil {
+		err = formatErr(err)
+		return
+	}
+
+	w, h, ok := header(b[:])
+	if !ok || isConchars(w, h, size) {
+		w = conWidth
+		h = conHeight
+	}
+
+	cfg = image.Config{
+		ColorModel: Palette,
+		Width:      w,
+		Height:     h,
 	}
 
 	return
@@ -54,42 +81,109 @@ func init() {
 	image.RegisterFormat("lmp", "", Decode, DecodeConfig)
 }
 
-func load(r io.Reader) (w, h int, b []byte, err error) {
-	var data bytes.Buffer
+const (
+	conWidth  = 128
+	conHeight = 128
+	maxSize   = 4096
+)
 
-	if _, err = data.ReadFrom(r); err != nil {
-		return
+func header(b []byte) (w, h int, ok bool) {
+	w = int(binary.LittleEndian.Uint32(b))
+	h = int(binary.LittleEndian.Uint32(b[4:]))
+	ok = w > 0 && h > 0 && w <= maxSize && h <= maxSize
+	return
+}
+
+// isConchars reports whether data of the given size, -1 if not known,
+// starting with a valid header of a w*h image is conchars. It is the rule
+// load follows while reading.
+func isConchars(w, h int, size int64) bool {
+	n := int64(8 + w*h)
+	if size == n || (n >= conWidth*conHeight && size >= n) {
+		return false
 	}
 
-	b = data.Bytes()
-	size := len(b)
+	return size == conWidth*conHeight
+}
 
-	if size < 8 {
-		err = ErrFormat
+func load(r io.Reader) (w, h int, b []byte, err error) {
+	var hdr [8]byte
+
+	if _, err = io.ReadFull(r, hdr[:]); err != nil {
+		err = formatErr(err)
 		return
 	}
 
-	w = int(binary.LittleEndian.Uint32(b))
-	h = int(binary.LittleEndian.Uint32(b[4:]))
-
-	if w*h >= size-8 {
+	var ok bool
+	if w, h, ok = header(hdr[:]); ok {
 		// Quake image with header
-		b = b[8 : 8+w*h]
-	} else if 128*128 == size {
-		// conchars, no header
-		w = 128
-		h = 128
-
-		// convert all black to transparent
-		for i := 0; i < w*h; i++ {
-			c := Palette[b[i]].(color.NRGBA)
-			if c.R == c.G && c.R == c.B && c.R == 0 {
-				b[i] = 255
+		b = make([]byte, w*h)
+
+		var n int
+		if n, err = io.ReadFull(r, b); err == nil {
+			if len(hdr)+n >= conWidth*conHeight {
+				return
 			}
+
+			// anything past the image means it's not a header
+			var extra [1]byte
+			if _, err = io.ReadFull(r, extra[:]); err == io.EOF {
+				err = nil
+				return
+			} else if err != nil {
+				return
+			}
+
+			b = append(b, extra[0])
+			n++
+		} else if err != io.ErrUnexpectedEOF && err != io.EOF {
+			return
 		}
+
+		// too short or too long for the header, has to be conchars
+		err = nil
+		b = append(hdr[:], b[:n]...)
 	} else {
+		b = hdr[:]
+	}
+
+	w = conWidth
+	h = conHeight
+
+	if n := len(b); n < w*h {
+		b = append(b, make([]byte, w*h-n)...)
+		if _, err = io.ReadFull(r, b[n:]); err != nil {
+			err = formatErr(err)
+			return
+		}
+	}
+
+	if len(b) != w*h || !atEOF(r) {
 		err = ErrFormat
+		return
+	}
+
+	// convert all black to transparent
+	for i := 0; i < w*h; i++ {
+		c := Palette[b[i]].(color.NRGBA)
+		if c.R == c.G && c.R == c.B && c.R == 0 {
+			b[i] = 255
+		}
 	}
 
 	return
 }
+
+func atEOF(r io.Reader) bool {
+	var b [1]byte
+	_, err := io.ReadFull(r, b[:])
+	return err == io.EOF
+}
+
+func formatErr(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return ErrFormat
+	}
+
+	return err
+}
@@ -1,9 +1,11 @@
 package lmp
 
 import (
+	"bytes"
 	"github.com/ftrvxmtrx/groke/archive/wad"
 	"github.com/ftrvxmtrx/tga"
 	"image"
+	"io"
 	"log"
 	"os"
 	"strings"
@@ -69,3 +71,101 @@ func TestLMP(t *testing.T) {
 
 	group.Wait()
 }
+
+func TestTranslateSkin(t *testing.T) {
+	m := image.NewPaletted(image.Rect(0, 0, 4, 1), Palette)
+	copy(m.Pix, []uint8{0, TopRange + 3, BottomRange + 3, 255})
+
+	out := TranslateSkin(m, 4, 12)
+	if want := []uint8{0, 4*16 + 3, 12*16 + 15 - 3, 255}; string(out.Pix) != string(want) {
+		t.Errorf("got %v, want %v", out.Pix, want)
+	}
+
+	if m.Pix[1] != TopRange+3 {
+		t.Error("source image modified")
+	}
+}
+
+type countingReader struct {
+	r io.Reader
+	n int
+}
+
+func (c *countingReader) Read(b []byte) (n int, err error) {
+	n, err = c.r.Read(b)
+	c.n += n
+	return
+}
+
+func TestDecodeStream(t *testing.T) {
+	b := make([]byte, 8+3*2)
+	b[0], b[4] = 3, 2
+
+	r := &countingReader{r: bytes.NewReader(b)}
+	if cfg, err := DecodeConfig(r); err != nil {
+		t.Fatal(err)
+	} else if cfg.Width != 3 || cfg.Height != 2 || r.n != 8 {
+		t.Fatalf("got %dx%d after %d bytes", cfg.Width, cfg.Height, r.n)
+	}
+
+	if m, err := Decode(bytes.NewReader(b)); err != nil {
+		t.Fatal(err)
+	} else if m.Bounds() != image.Rect(0, 0, 3, 2) {
+		t.Fatal(m.Bounds())
+	}
+
+	// conchars has no header
+	con := make([]byte, 128*128)
+	con[0], con[4] = 3, 2
+	if m, err := Decode(bytes.NewReader(con)); err != nil {
+		t.Fatal(err)
+	} else if m.Bounds() != image.Rect(0, 0, 128, 128) {
+		t.Fatal(m.Bounds())
+	}
+
+	// header only, and short pixel data
+	for _, n := range []int{8, 10} {
+		if _, err := Decode(bytes.NewReader(b[:n])); err != ErrFormat {
+			t.Fatalf("%d bytes: got %v, want ErrFormat", n, err)
+		}
+	}
+}
+
+func TestDecodeConfigConchars(t *testing.T) {
+	// Decode and DecodeConfig agree when the size is known
+	for _, c := range []struct {
+		w, h, size int
+	}{
+		{3, 2, 8 + 3*2},
+		{3, 2, 128 * 128},
+		{128, 127, 128 * 128},
+		{200, 200, 128 * 128},
+		{200, 200, 8 + 200*200},
+		{120, 136, 8 + 120*136},
+	} {
+		b := make([]byte, c.size)
+		b[0], b[4] = uint8(c.w), uint8(c.h)
+		b[1], b[5] = uint8(c.w>>8), uint8(c.h>>8)
+
+		m, err := Decode(bytes.NewReader(b))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		cfg, err := DecodeConfig(bytes.NewReader(b))
+		if err != nil {
+			t.Fatal(err)
+		} else if r := m.Bounds(); cfg.Width != r.Dx() || cfg.Height != r.Dy() {
+			t.Errorf("%dx%d in %d bytes: Decode %v, DecodeConfig %dx%d", c.w, c.h, c.size, r, cfg.Width, cfg.Height)
+		}
+	}
+
+	// with the size unknown the header is trusted
+	con := make([]byte, 128*128)
+	con[0], con[4] = 3, 2
+	if cfg, err := DecodeConfig(&countingReader{r: bytes.NewReader(con)}); err != nil {
+		t.Fatal(err)
+	} else if cfg.Width != 3 || cfg.Height != 2 {
+		t.Fatalf("got %dx%d", cfg.Width, cfg.Height)
+	}
+}
@@ -0,0 +1,54 @@
+package lmp
+
+import (
+	"image"
+)
+
+// Palette rows remapped by player colour translation.
+const (
+	TopRange    = 16 // shirt colour, palette row 1
+	BottomRange = 96 // pants colour, palette row 6
+)
+
+// Translation returns a palette index map that replaces the shirt and pants
+// rows with the given colour rows (0-13, as set by the "color" command).
+func Translation(top, bottom int) (t [256]uint8) {
+	for i := range t {
+		t[i] = uint8(i)
+	}
+
+	translateRow(&t, TopRange, top)
+	translateRow(&t, BottomRange, bottom)
+
+	return
+}
+
+// TranslateSkin returns a copy of m with the player colour translation
+// applied. The palette of m is kept.
+func TranslateSkin(m *image.Paletted, top, bottom int) *image.Paletted {
+	t := Translation(top, bottom)
+	out := image.NewPaletted(m.Rect, m.Palette)
+
+	for y := m.Rect.Min.Y; y < m.Rect.Max.Y; y++ {
+		src := m.Pix[m.PixOffset(m.Rect.Min.X, y):]
+		dst := out.Pix[out.PixOffset(out.Rect.Min.X, y):]
+		for x := 0; x < m.Rect.Dx(); x++ {
+			dst[x] = t[src[x]]
+		}
+	}
+
+	return out
+}
+
+func translateRow(t *[256]uint8, base, row int) {
+	c := (row & 15) << 4
+
+	for i := 0; i < 16; i++ {
+		// the artists made some backwards ranges
+		if c < 128 {
+			t[base+i] = uint8(c + i)
+		} else {
+			t[base+i] = uint8(c + 15 - i)
+		}
+	}
+}
@@ -0,0 +1,324 @@
+/*
+Package sky provides support for Quake family skies.
+
+Quake keeps its sky in a single two layer texture inside the map. Quake2,
+Half-Life and Quake3 use six separate images (a sky box) named after the sky
+set by the map.
+*/
+package sky
+
+import (
+	"errors"
+	"fmt"
+	"github.com/ftrvxmtrx/groke/image/detect"
+	_ "github.com/ftrvxmtrx/groke/image/pcx"
+	"github.com/ftrvxmtrx/groke/model/bsp"
+	"github.com/ftrvxmtrx/tga"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io"
+	"io/fs"
+	"strings"
+)
+
+var (
+	ErrFormat = errors.New("sky: not a valid sky texture")
+	ErrNoSky  = errors.New("sky: no sky set")
+)
+
+// Cubemap holds sky box faces in OpenGL cube map order: +X, -X, +Y, -Y, +Z,
+// -Z. Faces are oriented so the cube map can be sampled with Quake world
+// space directions.
+type Cubemap [6]image.Image
+
+// Cube map faces.
+const (
+	PosX = iota
+	NegX
+	PosY
+	NegY
+	PosZ
+	NegZ
+)
+
+// orient describes how a sky box image is turned into a cube map face:
+// transposed first, then flipped.
+type orient struct {
+	suffix    string
+	transpose bool
+	flipX     bool
+	flipY     bool
+}
+
+// side is a sky box side the way an engine draws it: the image drawn on it
+// and its st_to_vec entry, giving world axes of the s (1) and t (2) texture
+// directions and of the side itself (3), negative ones reversed.
+type side struct {
+	suffix string
+	vec    [3]int
+}
+
+// Layout describes where a game keeps its sky boxes.
+type Layout struct {
+	Name   string
+	Format string // path format, given the sky name and a face suffix
+	Exts   []string
+}
+
+// faces are the cube map orientations of sky box images. The engines share
+// the same st_to_vec table (GLQuake and Quake2 gl_warp.c, Quake3 tr_sky.c),
+// with their sky texture order applied, so the same images end up on the
+// same faces.
+var faces = orients([6]side{
+	{"rt", [3]int{3, -1, 2}},
+	{"lf", [3]int{-3, 1, 2}},
+	{"bk", [3]int{1, 3, 2}},
+	{"ft", [3]int{-1, -3, 2}},
+	{"up", [3]int{-2, -1, 3}},
+	{"dn", [3]int{2, -1, -3}},
+})
+
+var (
+	// Quake2 falls back to PCX images.
+	Quake2 = &Layout{
+		Name:   "quake2",
+		Format: "env/%s%s",
+		Exts:   []string{".tga", ".pcx"},
+	}
+
+	// Half-Life keeps the GLQuake sky box code (gl_warp.c), which only
+	// renders TGA images.
+	HalfLife = &Layout{
+		Name:   "halflife",
+		Format: "gfx/env/%s%s",
+		Exts:   []string{".tga"},
+	}
+
+	// Quake3 names faces with an underscore and falls back to JPEG images.
+	Quake3 = &Layout{
+		Name:   "quake3",
+		Format: "%s_%s",
+		Exts:   []string{".tga", ".jpg"},
+	}
+)
+
+// decoders decode images the detect package does not know about.
+var decoders = map[string]func(io.Reader) (image.Image, error){
+	".tga": tga.Decode,
+	".jpg": jpeg.Decode,
+}
+
+// cubeDir returns the world direction of cube map face coordinates sc and tc
+// (-1 to 1, right and down), as defined by OpenGL.
+func cubeDir(face, sc, tc int) (d [3]int) {
+	switch face {
+	case PosX:
+		d = [3]int{1, -tc, -sc}
+	case NegX:
+		d = [3]int{-1, -tc, sc}
+	case PosY:
+		d = [3]int{sc, 1, tc}
+	case NegY:
+		d = [3]int{sc, -1, -tc}
+	case PosZ:
+		d = [3]int{sc, -tc, 1}
+	case NegZ:
+		d = [3]int{-sc, -tc, -1}
+	}
+
+	return
+}
+
+// orients works out how images of the sides are put on cube map faces. An
+// engine maps s and t of -1 to 1 onto the image left to right and bottom to
+// top.
+func orients(sides [6]side) (faces [6]orient) {
+	// component n (1 for s, 2 for t, 3 for the axis) of direction d
+	st := func(vec [3]int, d [3]int, n int) int {
+		for j, k := range vec {
+			if k == n {
+				return d[j]
+			} else if k == -n {
+				return -d[j]
+			}
+		}
+		return 0
+	}
+
+	for _, sd := range sides {
+		face := 0
+		for j, k := range sd.vec {
+			if k == 3 || k == -3 {
+				face = j * 2
+				if k < 0 {
+					face++
+				}
+			}
+		}
+
+		o := orient{suffix: sd.suffix}
+		right, down := cubeDir(face, 1, 0), cubeDir(face, 0, 1)
+		if s := st(sd.vec, right, 1); s != 0 {
+			o.flipX = s < 0
+			o.flipY = st(sd.vec, down, 2) > 0
+		} else {
+			o.transpose = true
+			o.flipX = st(sd.vec, down, 1) < 0
+			o.flipY = st(sd.vec, right, 2) > 0
+		}
+
+		faces[face] = o
+	}
+
+	return
+}
+
+// SplitQuake splits a Quake sky texture into its solid back layer (right
+// half) and the front layer drawn over it (left half). Index 0 of the front
+// layer is transparent.
+func SplitQuake(m *image.Paletted) (back, front *image.Paletted, err error) {
+	w := m.Rect.Dx()
+	h := m.Rect.Dy()
+	if w == 0 || w%2 != 0 {
+		err = ErrFormat
+		return
+	}
+	w /= 2
+
+	p := make(color.Palette, len(m.Palette))
+	copy(p, m.Palette)
+	if len(p) > 0 {
+		p[0] = color.NRGBA{}
+	}
+
+	back = image.NewPaletted(image.Rect(0, 0, w, h), m.Palette)
+	front = image.NewPaletted(image.Rect(0, 0, w, h), p)
+	for y := 0; y < h; y++ {
+		row := m.Pix[m.PixOffset(m.Rect.Min.X, m.Rect.Min.Y+y):]
+		copy(front.Pix[y*w:], row[:w])
+		copy(back.Pix[y*w:], row[w:2*w])
+	}
+
+	return
+}
+
+// QuakeLayers finds the sky texture of a Quake map and splits it with
+// SplitQuake.
+func QuakeLayers(m *bsp.Model) (back, front *image.Paletted, err error) {
+	for _, t := range m.Textures {
+		if !strings.HasPrefix(t.Name, "sky") || t.External() {
+			continue
+		}
+
+		if p, ok := t.GetImage().(*image.Paletted); ok {
+			return SplitQuake(p)
+		}
+	}
+
+	err = ErrNoSky
+	return
+}
+
+// Load assembles the sky box set by the worldspawn entity of a map: "sky"
+// for Quake2 and "skyname" for Half-Life.
+func Load(fsys fs.FS, m *bsp.Model) (*Cubemap, error) {
+	for _, e := range m.Entities {
+		if e["classname"] != "worldspawn" {
+			continue
+		}
+
+		if name := e["skyname"]; name != "" {
+			return LoadNamed(fsys, HalfLife, name)
+		} else if name := e["sky"]; name != "" {
+			return LoadNamed(fsys, Quake2, name)
+		}
+
+		break
+	}
+
+	return nil, ErrNoSky
+}
+
+// LoadNamed assembles a sky box from six images found using the layout.
+// For Quake3 the name is the path given to skyparms, e.g. "env/space1".
+func LoadNamed(fsys fs.FS, l *Layout, name string) (c *Cubemap, err error) {
+	c = new(Cubemap)
+
+	for i, o := range faces {
+		var m image.Image
+		if m, err = loadFace(fsys, l, name, o.suffix); err != nil {
+			return nil, err
+		}
+
+		c[i] = o.apply(m)
+	}
+
+	return
+}
+
+func loadFace(fsys fs.FS, l *Layout, name, suffix string) (m image.Image, err error) {
+	base := fmt.Sprintf(l.Format, name, suffix)
+	err = fmt.Errorf("sky: %s: %w", base, fs.ErrNotExist)
+
+	// an image failing to decode is skipped for the next one, the error
+	// being kept in case none of them decodes
+	for _, ext := range l.Exts {
+		f, openErr := fsys.Open(base + ext)
+		if openErr != nil {
+			continue
+		}
+
+		size := int64(-1)
+		if fi, statErr := f.Stat(); statErr == nil {
+			size = fi.Size()
+		}
+
+		var decodeErr error
+		if decode, ok := decoders[ext]; ok {
+			m, decodeErr = decode(f)
+		} else {
+			m, _, decodeErr = detect.Decode(f, base+ext, size)
+		}
+		f.Close()
+
+		if decodeErr == nil {
+			return m, nil
+		}
+		err = fmt.Errorf("sky: %s%s: %v", base, ext, decodeErr)
+	}
+
+	return nil, err
+}
+
+func (o orient) apply(m image.Image) image.Image {
+	if !o.transpose && !o.flipX && !o.flipY {
+		return m
+	}
+
+	r := m.Bounds()
+	w, h := r.Dx(), r.Dy()
+	if o.transpose {
+		w, h = h, w
+	}
+
+	out := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			sx, sy := x, y
+			if o.transpose {
+				sx, sy = y, x
+			}
+			if o.flipX {
+				sx = r.Dx() - 1 - sx
+			}
+			if o.flipY {
+				sy = r.Dy() - 1 - sy
+			}
+
+			out.Set(x, y, m.At(r.Min.X+sx, r.Min.Y+sy))
+		}
+	}
+
+	return out
+}
@@ -0,0 +1,95 @@
+package sky
+
+import (
+	"errors"
+	"github.com/ftrvxmtrx/groke/image/lmp"
+	"github.com/ftrvxmtrx/groke/model/bsp"
+	"image"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+)
+
+func TestSplitQuake(t *testing.T) {
+	m := image.NewPaletted(image.Rect(0, 0, 4, 2), lmp.Palette)
+	copy(m.Pix, []uint8{0, 1, 2, 3, 4, 5, 6, 7})
+
+	back, front, err := SplitQuake(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(back.Pix) != "\x02\x03\x06\x07" || string(front.Pix) != "\x00\x01\x04\x05" {
+		t.Fatalf("back %v, front %v", back.Pix, front.Pix)
+	}
+
+	if _, _, _, a := front.At(0, 0).RGBA(); a != 0 {
+		t.Error("index 0 of the front layer is not transparent")
+	}
+
+	if _, _, _, a := back.At(0, 0).RGBA(); a == 0 {
+		t.Error("back layer is transparent")
+	}
+}
+
+// pcxData encodes a 2x2 PCX image with the Quake palette.
+func pcxData(pix [4]uint8) []byte {
+	b := make([]byte, 128)
+	copy(b, []byte{0x0a, 5, 1, 8, 0, 0, 0, 0, 1, 0, 1, 0})
+	b[65], b[66] = 1, 2
+	b = append(b, pix[:]...)
+	b = append(b, 0x0c)
+	for _, c := range lmp.Palette {
+		r, g, bl, _ := c.RGBA()
+		b = append(b, uint8(r>>8), uint8(g>>8), uint8(bl>>8))
+	}
+
+	return b
+}
+
+func TestLoad(t *testing.T) {
+	// 2x2 images, top left and top right pixels mark the face
+	fsys := fstest.MapFS{}
+	for i, s := range []string{"rt", "bk", "lf", "ft", "up", "dn"} {
+		fsys["env/unit1_"+s+".pcx"] = &fstest.MapFile{Data: pcxData([4]uint8{uint8(i + 1), uint8(i + 11), 0, 0})}
+	}
+
+	// broken images are skipped
+	fsys["env/unit1_rt.tga"] = &fstest.MapFile{Data: []byte("not a tga")}
+
+	m := &bsp.Model{Entities: []bsp.Entity{{"classname": "worldspawn", "sky": "unit1_"}}}
+	c, err := Load(fsys, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// where the marks of each source image end up
+	for i, want := range []struct {
+		face, x, y, rx, ry int
+	}{
+		{PosX, 0, 0, 0, 1},
+		{PosY, 0, 1, 1, 1},
+		{NegX, 1, 1, 1, 0},
+		{NegY, 1, 0, 0, 0},
+		{PosZ, 0, 0, 0, 1},
+		{NegZ, 0, 0, 0, 1},
+	} {
+		if got := c[want.face].At(want.x, want.y); got != lmp.Palette[i+1] {
+			t.Errorf("face %d: got %v at %d,%d", want.face, got, want.x, want.y)
+		}
+		if got := c[want.face].At(want.rx, want.ry); got != lmp.Palette[i+11] {
+			t.Errorf("face %d: got %v at %d,%d", want.face, got, want.rx, want.ry)
+		}
+	}
+
+	// decode errors are reported over missing images
+	fsys["env/unit1_up.pcx"] = &fstest.MapFile{Data: []byte("not a pcx")}
+	if _, err = Load(fsys, m); err == nil || errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected a decode error, got %v", err)
+	}
+
+	delete(fsys, "env/unit1_up.pcx")
+	if _, err = Load(fsys, m); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected fs.ErrNotExist, got %v", err)
+	}
+}
@@ -0,0 +1,179 @@
+/*
+Package texanim groups animated textures into frame sequences.
+
+Quake and Half-Life animate textures by name: "+0foo" to "+9foo" make up the
+primary sequence and "+afoo" to "+jfoo" the alternate one (shown on entities
+with a non-zero frame, like pressed buttons). Quake2 chains textures through
+the texinfo (or WAL) "next" field instead.
+*/
+package texanim
+
+import (
+	"time"
+)
+
+// Frame durations used by the engines.
+const (
+	// Quake and Half-Life count tenths of a second and hold each frame for
+	// two of them.
+	QuakeFrameTime = 200 * time.Millisecond
+	// Quake2 advances world texture animations twice a second.
+	Quake2FrameTime = 500 * time.Millisecond
+)
+
+const maxFrames = 10
+
+// Animation is a sequence of texture frames. Frames and alternates are
+// indices into the list of textures the animation was built from.
+type Animation struct {
+	Name       string
+	Frames     []int
+	Alternates []int
+	FrameTime  time.Duration
+}
+
+// Group builds animations out of Quake/Half-Life texture names. Sequences
+// stop at the first missing frame, as the engines refuse to load those.
+// Animations are returned in order of their first texture in names.
+func Group(names []string) (anims []*Animation) {
+	type frames struct {
+		primary [maxFrames]int
+		alt     [maxFrames]int
+	}
+
+	bases := make(map[string]*frames)
+	order := make([]string, 0)
+
+	for i, name := range names {
+		if len(name) < 3 || name[0] != '+' {
+			continue
+		}
+
+		base := name[2:]
+		f, ok := bases[base]
+		if !ok {
+			f = new(frames)
+			for j := 0; j < maxFrames; j++ {
+				f.primary[j] = -1
+				f.alt[j] = -1
+			}
+			bases[base] = f
+			order = append(order, base)
+		}
+
+		if c := name[1]; c >= '0' && c <= '9' {
+			f.primary[c-'0'] = i
+		} else if c >= 'a' && c <= 'j' {
+			f.alt[c-'a'] = i
+		} else if c >= 'A' && c <= 'J' {
+			f.alt[c-'A'] = i
+		}
+	}
+
+	for _, base := range order {
+		f := bases[base]
+		a := &Animation{
+			Name:      base,
+			FrameTime: QuakeFrameTime,
+		}
+
+		a.Frames = sequence(f.primary[:])
+		a.Alternates = sequence(f.alt[:])
+
+		if len(a.Frames) > 0 || len(a.Alternates) > 0 {
+			anims = append(anims, a)
+		}
+	}
+
+	return
+}
+
+// Chain builds animations out of Quake2 style links, where next[i] is the
+// index of the texture following names[i], or -1. Animations are named
+// after their first frame.
+func Chain(names []string, next []int) (anims []*Animation) {
+	hasPrev := make([]bool, len(next))
+	for i, n := range next {
+		if n >= 0 && n < len(next) && n != i {
+			hasPrev[n] = true
+		}
+	}
+
+	used := make([]bool, len(next))
+	walk := func(first int) {
+		a := &Animation{
+			Name:      names[first],
+			FrameTime: Quake2FrameTime,
+		}
+
+		for i := first; i >= 0 && i < len(next) && !used[i]; i = next[i] {
+			used[i] = true
+			a.Frames = append(a.Frames, i)
+		}
+
+		if len(a.Frames) > 1 {
+			anims = append(anims, a)
+		}
+	}
+
+	// open chains first, then whatever is left forms loops
+	for i := range next {
+		if !hasPrev[i] && !used[i] {
+			walk(i)
+		}
+	}
+
+	for i := range next {
+		if !used[i] {
+			walk(i)
+		}
+	}
+
+	return
+}
+
+// FrameAt returns the primary frame shown at time t, or -1 if there are no
+// primary frames.
+func (a *Animation) FrameAt(t time.Duration) int {
+	return a.at(a.Frames, t)
+}
+
+// AlternateAt returns the alternate frame shown at time t. Animations
+// without alternates fall back to the primary sequence.
+func (a *Animation) AlternateAt(t time.Duration) int {
+	if len(a.Alternates) == 0 {
+		return a.FrameAt(t)
+	}
+
+	return a.at(a.Alternates, t)
+}
+
+func (a *Animation) at(frames []int, t time.Duration) int {
+	if len(frames) == 0 {
+		return -1
+	}
+
+	ft := a.FrameTime
+	if ft <= 0 {
+		ft = QuakeFrameTime
+	}
+
+	i := int(int64(t/ft) % int64(len(frames)))
+	if i < 0 {
+		i += len(frames)
+	}
+
+	return frames[i]
+}
+
+func sequence(index []int) (s []int) {
+	for _, i := range index {
+		if i < 0 {
+			break
+		}
+
+		s = append(s, i)
+	}
+
+	return
+}
@@ -0,0 +1,66 @@
+package texanim
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestGroup(t *testing.T) {
+	names := []string{"+1slime", "wall", "+0slime", "+abutton", "+0button", "+2slime", "+4slime", "+Bbutton"}
+	anims := Group(names)
+
+	if len(anims) != 2 {
+		t.Fatalf("got %d animations", len(anims))
+	}
+
+	if a := anims[0]; a.Name != "slime" || !reflect.DeepEqual(a.Frames, []int{2, 0, 5}) || a.Alternates != nil {
+		t.Errorf("unexpected %+v", a)
+	}
+
+	if a := anims[1]; a.Name != "button" || !reflect.DeepEqual(a.Frames, []int{4}) || !reflect.DeepEqual(a.Alternates, []int{3, 7}) {
+		t.Errorf("unexpected %+v", a)
+	}
+}
+
+func TestChain(t *testing.T) {
+	names := []string{"a", "b", "c", "d", "e"}
+	anims := Chain(names, []int{2, -1, 0, 4, -1})
+
+	if len(anims) != 2 {
+		t.Fatalf("got %d animations", len(anims))
+	}
+
+	if a := anims[0]; a.Name != "d" || !reflect.DeepEqual(a.Frames, []int{3, 4}) {
+		t.Errorf("unexpected %+v", a)
+	}
+
+	if a := anims[1]; a.Name != "a" || !reflect.DeepEqual(a.Frames, []int{0, 2}) {
+		t.Errorf("unexpected %+v", a)
+	}
+}
+
+func TestFrameAt(t *testing.T) {
+	a := &Animation{Frames: []int{7, 8, 9}, FrameTime: QuakeFrameTime}
+
+	for _, c := range []struct {
+		t    time.Duration
+		want int
+	}{
+		{0, 7},
+		{199 * time.Millisecond, 7},
+		{200 * time.Millisecond, 8},
+		{500 * time.Millisecond, 9},
+		{600 * time.Millisecond, 7},
+		{-100 * time.Millisecond, 7},
+		{-300 * time.Millisecond, 9},
+	} {
+		if got := a.FrameAt(c.t); got != c.want {
+			t.Errorf("FrameAt(%v) = %d, want %d", c.t, got, c.want)
+		}
+	}
+
+	if got := a.AlternateAt(200 * time.Millisecond); got != 8 {
+		t.Errorf("AlternateAt fallback = %d", got)
+	}
+}
@@ -0,0 +1,94 @@
+package text
+
+import (
+	"encoding/binary"
+	"image"
+	"image/color"
+	"io"
+)
+
+const (
+	hlFontHeaderLen = 16 + 256*4
+	hlFontMaxSize   = 4096
+)
+
+// DecodeHLFont decodes a Half-Life font (the "qfont" lumps of gfx.wad and
+// fonts.wad). Palette index 255 is transparent.
+func DecodeHLFont(r io.Reader) (f *Font, err error) {
+	b := make([]byte, hlFontHeaderLen)
+	if _, err = io.ReadFull(r, b); err != nil {
+		err = formatErr(err)
+		return
+	}
+
+	width := int(binary.LittleEndian.Uint32(b))
+	height := int(binary.LittleEndian.Uint32(b[4:]))
+	rowHeight := int(binary.LittleEndian.Uint32(b[12:]))
+	if width <= 0 || height <= 0 || width > hlFontMaxSize || height > hlFontMaxSize || rowHeight <= 0 {
+		err = ErrFormat
+		return
+	}
+
+	data := make([]byte, width*height+2+256*3)
+	if _, err = io.ReadFull(r, data); err != nil {
+		err = formatErr(err)
+		return
+	}
+
+	pix := data[:width*height]
+	pal := data[width*height+2:]
+	if n := int(binary.LittleEndian.Uint16(data[width*height:])); n != 256 {
+		err = ErrFormat
+		return
+	}
+
+	p := make(color.Palette, 256)
+	for i := range p {
+		p[i] = color.NRGBA{pal[i*3], pal[i*3+1], pal[i*3+2], 0xff}
+	}
+
+	m := &image.Paletted{
+		Pix:     pix,
+		Stride:  width,
+		Rect:    image.Rect(0, 0, width, height),
+		Palette: transparentPalette(p, 255),
+	}
+
+	f = &Font{
+		Image:  m,
+		Height: rowHeight,
+	}
+
+	for i := range f.Glyphs {
+		info := b[16+i*4:]
+		offset := int(binary.LittleEndian.Uint16(info))
+		w := int(binary.LittleEndian.Uint16(info[2:]))
+		min := image.Pt(offset%width, offset/width)
+
+		f.Glyphs[i] = Glyph{
+			Rect:    image.Rectangle{min, min.Add(image.Pt(w, rowHeight))}.Intersect(m.Rect),
+			Advance: w,
+		}
+	}
+
+	return
+}
+
+// transparentPalette returns a copy of p with the given index transparent.
+func transparentPalette(p color.Palette, index int) color.Palette {
+	out := make(color.Palette, len(p))
+	copy(out, p)
+	if index < len(out) {
+		out[index] = color.NRGBA{}
+	}
+
+	return out
+}
+
+func formatErr(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return ErrFormat
+	}
+
+	return err
+}
@@ -0,0 +1,182 @@
+/*
+Package text draws strings with Quake and Half-Life bitmap fonts.
+
+Strings are treated as the engines do: as bytes, not runes. Quake keeps a
+red/gold variant of every character 128 positions above it, see Alt.
+*/
+package text
+
+import (
+	"errors"
+	"image"
+	"image/draw"
+	"strings"
+)
+
+var (
+	ErrFormat = errors.New("text: not a valid font")
+)
+
+// Glyph is a character of a font.
+type Glyph struct {
+	Rect    image.Rectangle // location in Font.Image
+	Advance int
+}
+
+type Font struct {
+	Image  image.Image
+	Glyphs [256]Glyph
+	Height int // line height
+}
+
+// Conchars makes a font out of the Quake conchars image: a 16x16 grid of
+// square characters (8x8 in the original 128x128 image). Transparent pixels
+// are left untouched when drawing.
+func Conchars(m image.Image) (f *Font, err error) {
+	r := m.Bounds()
+	if r.Dx() == 0 || r.Dx()%16 != 0 || r.Dy() != r.Dx() {
+		err = ErrFormat
+		return
+	}
+
+	size := r.Dx() / 16
+	f = &Font{
+		Image:  m,
+		Height: size,
+	}
+
+	for i := range f.Glyphs {
+		min := r.Min.Add(image.Pt(i%16*size, i/16*size))
+		f.Glyphs[i] = Glyph{
+			Rect:    image.Rectangle{min, min.Add(image.Pt(size, size))},
+			Advance: size,
+		}
+	}
+
+	return
+}
+
+// Alt returns s with every character switched to its red/gold variant, the
+// way Quake prints player names and chat messages.
+func Alt(s string) string {
+	b := []byte(s)
+	for i, c := range b {
+		if c != '\n' {
+			b[i] = c | 0x80
+		}
+	}
+
+	return string(b)
+}
+
+// Draw draws s with the top left corner of its first line at pt. Lines are
+// broken on '\n' only. The returned point is where the next character would
+// be drawn.
+func (f *Font) Draw(dst draw.Image, pt image.Point, s string) image.Point {
+	x := pt.X
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c == '\n' {
+			pt = image.Pt(x, pt.Y+f.Height)
+			continue
+		}
+
+		g := &f.Glyphs[c]
+		if c != ' ' && !g.Rect.Empty() {
+			r := image.Rectangle{pt, pt.Add(g.Rect.Size())}
+			draw.Draw(dst, r, f.Image, g.Rect.Min, draw.Over)
+		}
+
+		pt.X += g.Advance
+	}
+
+	return pt
+}
+
+// DrawWrapped draws s wrapped to the given width (see Wrap) and returns the
+// point below the last line.
+func (f *Font) DrawWrapped(dst draw.Image, pt image.Point, s string, width int) image.Point {
+	for _, line := range f.Wrap(s, width) {
+		f.Draw(dst, pt, line)
+		pt.Y += f.Height
+	}
+
+	return pt
+}
+
+// Measure returns the size s takes when drawn: the width of its longest line
+// and the height of all of them.
+func (f *Font) Measure(s string) (size image.Point) {
+	for _, line := range strings.Split(s, "\n") {
+		if w := f.width(line); w > size.X {
+			size.X = w
+		}
+		size.Y += f.Height
+	}
+
+	return
+}
+
+// Wrap splits s into lines no wider than width, breaking on '\n' and
+// spaces. Words too long to fit a line on their own are broken anywhere,
+// characters wider than width getting lines of their own.
+func (f *Font) Wrap(s string, width int) (lines []string) {
+	for _, para := range strings.Split(s, "\n") {
+		line := ""
+
+		for _, word := range strings.Split(para, " ") {
+			cand := word
+			if line != "" {
+				cand = line + " " + word
+			}
+
+			if f.width(cand) <= width {
+				line = cand
+				continue
+			}
+
+			if line != "" {
+				lines = append(lines, line)
+			}
+
+			for f.width(word) > width {
+				n := f.fit(word, width)
+				if n == len(word) {
+					// a single character wider than the line
+					break
+				}
+				lines = append(lines, word[:n])
+				word = word[n:]
+			}
+			line = word
+		}
+
+		lines = append(lines, line)
+	}
+
+	return
+}
+
+func (f *Font) width(s string) (w int) {
+	for i := 0; i < len(s); i++ {
+		w += f.Glyphs[s[i]].Advance
+	}
+
+	return
+}
+
+// fit returns how many leading characters of s fit into width, at least one.
+func (f *Font) fit(s string, width int) int {
+	w := 0
+	for i := 0; i < len(s); i++ {
+		if w += f.Glyphs[s[i]].Advance; w > width {
+			if i == 0 {
+				return 1
+			}
+			return i
+		}
+	}
+
+	return len(s)
+}
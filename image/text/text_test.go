@@ -0,0 +1,108 @@
+package text
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"reflect"
+	"testing"
+)
+
+// testConchars makes a 128x128 conchars where every character is filled
+// with its own index, except for 0 which is transparent.
+func testConchars() *image.Paletted {
+	p := make(color.Palette, 256)
+	for i := range p {
+		p[i] = color.NRGBA{uint8(i), uint8(i), uint8(i), 0xff}
+	}
+	p[0] = color.NRGBA{}
+
+	m := image.NewPaletted(image.Rect(0, 0, 128, 128), p)
+	for y := 0; y < 128; y++ {
+		for x := 0; x < 128; x++ {
+			m.Pix[y*128+x] = uint8(y/8*16 + x/8)
+		}
+	}
+
+	return m
+}
+
+func TestDraw(t *testing.T) {
+	f, err := Conchars(testConchars())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dst := image.NewNRGBA(image.Rect(0, 0, 64, 32))
+	end := f.Draw(dst, image.Pt(1, 2), "ab\n"+Alt("c"))
+
+	if end != image.Pt(9, 10) {
+		t.Errorf("end at %v", end)
+	}
+
+	for _, c := range []struct {
+		x, y int
+		want uint8
+	}{
+		{1, 2, 'a'},
+		{8, 9, 'a'},
+		{9, 2, 'b'},
+		{1, 10, 'c' | 0x80},
+		{0, 0, 0},
+		{17, 2, 0},
+	} {
+		if got := dst.NRGBAAt(c.x, c.y).R; got != c.want {
+			t.Errorf("%d,%d: got %d, want %d", c.x, c.y, got, c.want)
+		}
+	}
+
+	if size := f.Measure("abc\nde"); size != image.Pt(24, 16) {
+		t.Errorf("measured %v", size)
+	}
+}
+
+func TestWrap(t *testing.T) {
+	f, _ := Conchars(testConchars())
+
+	for _, c := range []struct {
+		s     string
+		width int
+		want  []string
+	}{
+		{"the slipgate complex", 10 * 8, []string{"the", "slipgate", "complex"}},
+		{"the slipgate complex", 12 * 8, []string{"the slipgate", "complex"}},
+		{"abcdefgh ij", 3 * 8, []string{"abc", "def", "gh", "ij"}},
+		{"a\n\nb", 8, []string{"a", "", "b"}},
+		{"ab c", 0, []string{"a", "b", "c"}},
+		{"ab c", -8, []string{"a", "b", "c"}},
+	} {
+		if got := f.Wrap(c.s, c.width); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("Wrap(%q, %d) = %q, want %q", c.s, c.width, got, c.want)
+		}
+	}
+}
+
+func TestDecodeHLFont(t *testing.T) {
+	var b bytes.Buffer
+	binary.Write(&b, binary.LittleEndian, []int32{256, 16, 1, 16})
+	for i := 0; i < 256; i++ {
+		binary.Write(&b, binary.LittleEndian, []uint16{uint16(i % 32 * 8), 8})
+	}
+	b.Write(make([]byte, 256*16))
+	binary.Write(&b, binary.LittleEndian, uint16(256))
+	b.Write(make([]byte, 768))
+
+	f, err := DecodeHLFont(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if g := f.Glyphs[33]; g.Rect != image.Rect(8, 0, 16, 16) || g.Advance != 8 || f.Height != 16 {
+		t.Errorf("unexpected glyph %+v", g)
+	}
+
+	if _, err = DecodeHLFont(bytes.NewReader(make([]byte, 100))); err != ErrFormat {
+		t.Errorf("got %v, want ErrFormat", err)
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"image"
 	"image/color"
 	"io"
+	"io/ioutil"
 )
 
 var Palette color.Palette
@@ -18,6 +19,11 @@ var (
 	ErrFormat = errors.New("wal: not a valid wal file")
 )
 
+const (
+	headerLen = 100
+	maxSize   = 4096
+)
+
 // Contents is a type for contents flags.
 type Contents uint32
 
@@ -124,56 +130,61 @@ type WAL struct {
 
 // Decode decodes a WAL image.
 func Decode(r io.Reader) (outImage image.Image, err error) {
-	var data bytes.Buffer
-
-	if _, err = data.ReadFrom(r); err != nil {
-		return
-	}
-
-	b := data.Bytes()
+	b := make([]byte, headerLen)
 
-	if len(b) < 100 {
-		err = ErrFormat
+	if _, err = io.ReadFull(r, b); err != nil {
+		err = formatErr(err)
 		return
 	}
 
-	nameLen := bytes.IndexByte(b, 0)
-	if nameLen < 0 || nameLen > 32 {
+	nameLen := bytes.IndexByte(b[:32], 0)
+	if nameLen < 0 {
 		nameLen = 32
 	}
 	name := string(b[:nameLen])
 
-	w := int(LittleEndian.Uint32(b[32:]))
-	h := int(LittleEndian.Uint32(b[36:]))
+	w, h, ok := size(b)
+	offset := int(LittleEndian.Uint32(b[40:]))
 	flags := SurfFlags(LittleEndian.Uint32(b[88:]))
 	contents := Contents(LittleEndian.Uint32(b[92:]))
 	value := LittleEndian.Uint32(b[96:])
 
-	nextLen := bytes.IndexByte(b[56:], 0)
-	if nextLen < 0 || nextLen > 32 {
+	nextLen := bytes.IndexByte(b[56:88], 0)
+	if nextLen < 0 {
 		nextLen = 32
 	}
 	nextName := string(b[56 : 56+nextLen])
 
-	b = b[100:]
-
-	if w*h > len(b) {
+	if !ok || offset < headerLen {
 		err = ErrFormat
-	} else {
-		rect := image.Rect(0, 0, w, h)
-		outImage = &WAL{
-			&image.Paletted{
-				Pix:     b,
-				Stride:  w,
-				Rect:    rect,
-				Palette: Palette,
-			},
-			name,
-			nextName,
-			flags,
-			contents,
-			value,
-		}
+		return
+	}
+
+	// skip to the first mip level, then read only it
+	if _, err = io.CopyN(ioutil.Discard, r, int64(offset-headerLen)); err != nil {
+		err = formatErr(err)
+		return
+	}
+
+	pix := make([]byte, w*h)
+	if _, err = io.ReadFull(r, pix); err != nil {
+		err = formatErr(err)
+		return
+	}
+
+	rect := image.Rect(0, 0, w, h)
+	outImage = &WAL{
+		&image.Paletted{
+			Pix:     pix,
+			Stride:  w,
+			Rect:    rect,
+			Palette: Palette,
+		},
+		name,
+		nextName,
+		flags,
+		contents,
+		value,
 	}
 
 	return
@@ -183,13 +194,15 @@ func Decode(r io.Reader) (outImage image.Image, err error) {
 // configuration.
 func DecodeConfig(r io.Reader) (cfg image.Config, err error) {
 	b := make([]byte, 40)
-	var n int
 
-	if n, err = r.Read(b); n < len(b) {
+	if _, err = io.ReadFull(r, b); err != nil {
+		err = formatErr(err)
+	} else if w, h, ok := size(b); !ok {
 		err = ErrFormat
-	} else if err == nil {
-		cfg.Width = int(LittleEndian.Uint32(b[32:]))
-		cfg.Height = int(LittleEndian.Uint32(b[36:]))
+	} else {
+		cfg.ColorModel = Palette
+		cfg.Width = w
+		cfg.Height = h
 	}
 
 	return
@@ -243,3 +256,18 @@ func (c SurfFlags) String() (s string) {
 
 	return "(" + s + ")"
 }
+
+func size(b []byte) (w, h int, ok bool) {
+	w = int(LittleEndian.Uint32(b[32:]))
+	h = int(LittleEndian.Uint32(b[36:]))
+	ok = w > 0 && h > 0 && w <= maxSize && h <= maxSize
+	return
+}
+
+func formatErr(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return ErrFormat
+	}
+
+	return err
+}
@@ -1,9 +1,11 @@
 package wal
 
 import (
+	"bytes"
 	"github.com/ftrvxmtrx/groke/archive/pak"
 	"github.com/ftrvxmtrx/tga"
 	"image"
+	"io"
 	"log"
 	"os"
 	"strings"
@@ -71,3 +73,31 @@ func TestWAD(t *testing.T) {
 
 	group.Wait()
 }
+
+func TestDecodeStream(t *testing.T) {
+	b := make([]byte, 100+4*2+2+1)
+	copy(b, "e1u1/test")
+	b[32], b[36], b[40] = 4, 2, 100
+	b[100] = 7
+
+	var r io.Reader = io.LimitReader(bytes.NewReader(b), 40)
+	if cfg, err := DecodeConfig(r); err != nil {
+		t.Fatal(err)
+	} else if cfg.Width != 4 || cfg.Height != 2 {
+		t.Fatalf("got %dx%d", cfg.Width, cfg.Height)
+	}
+
+	m, err := Decode(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := m.(*WAL)
+	if w.Name != "e1u1/test" || len(w.Image.(*image.Paletted).Pix) != 8 || w.Image.(*image.Paletted).Pix[0] != 7 {
+		t.Fatalf("unexpected %+v", w)
+	}
+
+	if _, err = Decode(bytes.NewReader(b[:104])); err != ErrFormat {
+		t.Fatalf("got %v, want ErrFormat", err)
+	}
+}
@@ -0,0 +1,55 @@
+package bsp
+
+import (
+	"github.com/ftrvxmtrx/groke/image/texanim"
+)
+
+// Animations returns animated texture sequences of the model. Frames are
+// indices into m.Textures.
+func (m *Model) Animations() []*texanim.Animation {
+	names := make([]string, len(m.Textures))
+	next := make([]int, len(m.Textures))
+	index := make(map[*Texture]int, len(m.Textures))
+
+	for i := range m.Textures {
+		names[i] = m.Textures[i].Name
+		index[&m.Textures[i]] = i
+	}
+
+	for i := range m.Textures {
+		next[i] = -1
+		if j, ok := index[m.Textures[i].Next]; ok {
+			next[i] = j
+		}
+	}
+
+	if anims := texanim.Group(names); len(anims) > 0 {
+		return anims
+	}
+
+	return texanim.Chain(names, next)
+}
+
+// linkAnimations sets Next fields of Quake/Half-Life textures the same way
+// Quake2 does, so every frame points to the following one.
+func linkAnimations(texs []Texture) {
+	names := make([]string, len(texs))
+	for i := range texs {
+		names[i] = texs[i].Name
+	}
+
+	for _, a := range texanim.Group(names) {
+		linkFrames(texs, a.Frames)
+		linkFrames(texs, a.Alternates)
+	}
+}
+
+func linkFrames(texs []Texture, frames []int) {
+	if len(frames) < 2 {
+		return
+	}
+
+	for i, f := range frames {
+		texs[f].Next = &texs[frames[(i+1)%len(frames)]]
+	}
+}
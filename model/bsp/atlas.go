@@ -0,0 +1,21 @@
+package bsp
+
+import (
+	"github.com/ftrvxmtrx/groke/image/atlas"
+	"image"
+)
+
+// Atlas packs all textures stored in the map into atlas pages. Entries of
+// the returned atlas line up with m.Textures; external and missing textures
+// are left out (their Page is -1).
+func (m *Model) Atlas(o *atlas.Options) (*atlas.Atlas, error) {
+	images := make([]image.Image, len(m.Textures))
+
+	for i, t := range m.Textures {
+		if t.DataSource != nil && !t.External() {
+			images[i] = t.GetImage()
+		}
+	}
+
+	return atlas.Pack(images, o)
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"errors"
 	"image"
+	"image/color"
 	"io"
 )
 
@@ -47,38 +48,147 @@ func (s dataSourceInternal) GetImage() image.Image {
 
 type Texture struct {
 	DataSource
-	Name string
-	Next *Texture
+	Name   string
+	Next   *Texture
+	Width  int // 0 if not known, see Model.SetTextureSize
+	Height int
 }
 
 type TexInfo struct {
-	S       Vector3
-	T       Vector3
-	Ds      float64
-	Dt      float64
-	Texture *Texture
-	Flags   TexFlags
+	S            Vector3
+	T            Vector3
+	Ds           float64
+	Dt           float64
+	Texture      *Texture
+	Flags        TexFlags
+	SurfaceFlags Q3SurfFlags // Quake3 only
+	Contents     Q3Contents  // Quake3 only
+}
+
+// Effect is a fog volume of a Quake3 map.
+type Effect struct {
+	Shader string
+	Brush  int
+	Side   int // visible side of the brush, -1 if none
+}
+
+// Flare is a light flare (billboard surface) of a Quake3 map.
+type Flare struct {
+	Origin Vector3
+	Normal Vector3
+	Color  Vector3 // 0-1 for each component
+	Shader string
+	Effect int // index into Model.Effects, -1 if none
 }
 
 type Entity map[string]string
 
 type Vert struct {
-	Pos Vector3
+	Pos           Vector3
+	Normal        Vector3     // Quake3 only
+	TexCoord      [2]float64  // 0-1 across the texture, repeating
+	LightmapCoord [2]float64  // 0-1 within Face.Lightmap, or the lightmap page for Quake3
+	Color         color.NRGBA // vertex lighting, Quake3 only
 }
 
 type Face struct {
-	Verts   []Vert
-	Front   bool
-	Plane   *Plane
-	TexInfo TexInfo
+	// Verts is the winding of a polygon. Quake3 meshes and patches are not
+	// polygons and are only to be drawn through Indices.
+	Verts []Vert
+
+	// Indices is a triangle list into Verts for Quake3 faces, nil for
+	// polygons. See Triangles.
+	Indices []int
+
+	Front       bool
+	Plane       *Plane
+	Normal      Vector3 // facing the front side
+	TexInfo     TexInfo
+	Effect      int       // index into Model.Effects, -1 if none
+	LightOffset int       // offset into the lightmap lump, -1 if unlit
+	Lightmap    *Lightmap // nil if unlit or read with NoLightmaps
+
+	// LightmapPage is an index into Model.LightmapPages for Quake3 faces,
+	// -1 if there is no lightmap.
+	LightmapPage int
+}
+
+// Node is a node of the BSP tree, splitting space with a plane. Children are
+// indices into Model.Nodes, or -(leaf+1) for leaves, the first one being on
+// the front side of the plane.
+type Node struct {
+	Plane    *Plane
+	Children [2]int
+	Mins     Vector3
+	Maxs     Vector3
+
+	// FirstFace and NumFaces are the range of Model.Faces lying on the
+	// plane, empty for Quake3 maps.
+	FirstFace int
+	NumFaces  int
+}
+
+// Leaf is a convex area of space at the bottom of the BSP tree.
+type Leaf struct {
+	Contents  int // Q1Contents* for Quake and Half-Life, Quake2 contents flags, 0 for Quake3
+	Cluster   int // visibility cluster of Quake2 and Quake3 maps, -1 if none
+	VisOffset int // offset into the visibility lump of Quake and Half-Life maps, -1 if none
+	Area      int // Quake2 and Quake3 only
+	Mins      Vector3
+	Maxs      Vector3
+	Faces     []int // indices into Model.Faces
+	Brushes   []int // indices into the brush lump, Quake2 and Quake3 only
+
+	// Ambient are levels of water, sky, slime and lava ambient sounds,
+	// Quake and Half-Life only.
+	Ambient [4]uint8
 }
 
 type Model struct {
-	Triangle bool // FIXME -- Q3 uses triangles
 	Entities []Entity
+	Planes   []Plane
+	Nodes    []Node // the first one is the root of the world
+	Leaves   []Leaf
 	Faces    []Face
 	TexInfos []TexInfo
 	Textures []Texture
+	Effects  []Effect
+	Flares   []Flare
+	Lit      *Lit
+
+	// LightmapPages are the lightmaps of Quake3 maps, shared by faces.
+	LightmapPages []*image.RGBA
+
+	// PVS holds decompressed potentially visible sets, one bit per leaf
+	// or cluster. Rows are per leaf for Quake and Half-Life maps, nil for
+	// leaves seeing everything, with bit i standing for leaf i+1. Rows are
+	// per cluster for Quake2 and Quake3 maps. See CanSee.
+	PVS [][]byte
+
+	// PHS holds potentially hearable sets of Quake2 maps, laid out as PVS.
+	PHS [][]byte
+
+	visClusters bool
+	litable     bool // greyscale lightmaps a .lit file may replace
+	opts        Options
+}
+
+// Options tune how maps are read. The zero value reads maps the way Read
+// does.
+type Options struct {
+	// Q3OverbrightBits is the number of bits Quake3 lightmaps and vertex
+	// colours are shifted by when read. Colours are scaled down when any
+	// component overflows. It is 0 by default, keeping the colours as they
+	// are stored in the map, for renderers applying overbright lighting
+	// themselves. The game shifts by its r_mapOverBrightBits, 2 by default,
+	// less the bits taken by hardware gamma.
+	Q3OverbrightBits uint
+
+	// Q3PatchLevel is the number of segments every quadratic piece of a
+	// Quake3 patch is tessellated into along each direction, 8 if not
+	// positive. All pieces are tessellated the same way, so patches sharing
+	// an edge meet without cracks.
+	Q3PatchLevel int
 }
 
 type bspReader func(io.Reader, int, *Model) error
@@ -112,10 +222,21 @@ const (
 	TexAnimated = TexFlags(1 << iota)
 )
 
+// Contents of Quake and Half-Life leaves.
+const (
+	Q1ContentsEmpty = -1 - iota
+	Q1ContentsSolid
+	Q1ContentsWater
+	Q1ContentsSlime
+	Q1ContentsLava
+	Q1ContentsSky
+)
+
 const (
 	EntitiesOnly = 1 << iota
 	NoTextures
 	NoLightmaps
+	NoVisibility
 )
 
 var bspLoaders = []*bspLoader{
@@ -133,7 +254,13 @@ func (t PlaneType) String() string {
 	return pt2String[t]
 }
 
+// Read reads a map with the default options.
 func Read(r io.Reader, flags int) (mp *Model, err error) {
+	return ReadWith(r, flags, Options{})
+}
+
+// ReadWith reads a map with the given options.
+func ReadWith(r io.Reader, flags int, opts Options) (mp *Model, err error) {
 	id := make([]byte, 4)
 	if _, err = r.Read(id); err != nil {
 		return
@@ -153,7 +280,7 @@ func Read(r io.Reader, flags int) (mp *Model, err error) {
 		}
 
 		if bytes.Compare(id, bh.id) == 0 {
-			var m Model
+			m := Model{opts: opts}
 			err = bh.read(r, flags, &m)
 			mp = &m
 			break
@@ -162,3 +289,26 @@ func Read(r io.Reader, flags int) (mp *Model, err error) {
 
 	return
 }
+
+// Triangles returns the triangles of a face as indices into Verts. Polygons
+// are triangulated as fans.
+func (f *Face) Triangles() (tris [][3]int) {
+	if f.Indices != nil {
+		tris = make([][3]int, 0, len(f.Indices)/3)
+		for i := 0; i+2 < len(f.Indices); i += 3 {
+			tris = append(tris, [3]int{f.Indices[i], f.Indices[i+1], f.Indices[i+2]})
+		}
+		return
+	}
+
+	if len(f.Verts) < 3 {
+		return nil
+	}
+
+	tris = make([][3]int, 0, len(f.Verts)-2)
+	for i := 1; i+1 < len(f.Verts); i++ {
+		tris = append(tris, [3]int{0, i, i + 1})
+	}
+
+	return
+}
@@ -1,13 +1,19 @@
 package bsp
 
 import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
 	"github.com/ftrvxmtrx/tga"
 	"image"
+	"image/color"
 	"log"
 	"os"
+	"reflect"
 	"strings"
 	"sync"
 	"testing"
+	"testing/fstest"
 )
 
 func encode(m image.Image, name string) (err error) {
@@ -80,3 +86,714 @@ func TestRead(t *testing.T) {
 
 	group.Wait()
 }
+
+// buildBSP puts lumps together into a map with the given header id.
+func buildBSP(id []byte, lumps [][]byte) []byte {
+	b := append([]byte{}, id...)
+	offset := len(id) + 8*len(lumps)
+	for _, l := range lumps {
+		b = binary.LittleEndian.AppendUint32(b, uint32(offset))
+		b = binary.LittleEndian.AppendUint32(b, uint32(len(l)))
+		offset += len(l)
+	}
+
+	for _, l := range lumps {
+		b = append(b, l...)
+	}
+
+	return b
+}
+
+func q1TestMap() []byte {
+	lumps := make([][]byte, q1NumLumps)
+	lumps[q1LumpEntities] = []byte("{\n\"classname\" \"worldspawn\"\n}\n")
+	lumps[q1LumpTextures] = make([]byte, 4)
+	lumps[q1LumpLightmaps] = []byte{1, 2, 3, 4}
+	return buildBSP([]byte{0x1d, 0, 0, 0}, lumps)
+}
+
+func le(data ...interface{}) []byte {
+	var b bytes.Buffer
+	for _, d := range data {
+		binary.Write(&b, binary.LittleEndian, d)
+	}
+	return b.Bytes()
+}
+
+// faceMap returns a Quake or Half-Life map with a single 32x16 face lit
+// with two styles, with the given number of bytes per lightmap sample.
+func faceMap(id []byte, sampleSize int) []byte {
+	lumps := make([][]byte, q1NumLumps)
+	lumps[q1LumpEntities] = []byte("{\n\"classname\" \"worldspawn\"\n}\n")
+
+	// 16x8 texture, readable as both Quake and Half-Life one
+	var name [16]byte
+	copy(name[:], "wall")
+	lumps[q1LumpTextures] = le(uint32(1), uint32(8), name, uint32(16), uint32(8), [4]uint32{40}, make([]byte, 16*8), uint16(0))
+	lumps[q1LumpPlanes] = le(q1Plane{N: [3]float32{0, 0, 1}, T: PlaneAxialZ})
+	lumps[q1LumpVertices] = le([][3]float32{{0, 0, 0}, {32, 0, 0}, {32, 16, 0}, {0, 16, 0}})
+	lumps[q1LumpTextureInformation] = le(q1TexInfo{S: [3]float32{1, 0, 0}, T: [3]float32{0, 1, 0}, Dt: 8})
+	lumps[q1LumpEdges] = le([]q1EdgeIndex{{}, {0, 1}, {1, 2}, {2, 3}, {3, 0}})
+	lumps[q1LumpFaceEdgeTables] = le([]int32{1, 2, 3, 4})
+	lumps[q1LumpFaces] = le(q1Face{NumEdges: 4, Styles: [4]uint8{0, 1, 255, 255}})
+
+	// a single node on the face plane, solid below
+	lumps[q1LumpNodes] = le(q1Node{Children: [2]int16{-2, -1}, Mins: [3]int16{0, 0, -16}, Maxs: [3]int16{32, 16, 16}, NumFaces: 1})
+	lumps[q1LumpLeaves] = le(
+		q1Leaf{Contents: Q1ContentsSolid, VisOffset: -1},
+		q1Leaf{Contents: Q1ContentsEmpty, Maxs: [3]int16{32, 16, 16}, NumMarkSurfaces: 1, Ambient: [4]uint8{0, 255, 0, 0}},
+	)
+	lumps[q1LumpMarkSurfaces] = le(uint16(0))
+	lumps[q1LumpVisibility] = []byte{0x01}
+
+	// 3x3 luxels per style
+	for i := 0; i < 18*sampleSize; i++ {
+		lumps[q1LumpLightmaps] = append(lumps[q1LumpLightmaps], uint8(i))
+	}
+
+	return buildBSP(id, lumps)
+}
+
+func TestLightmaps(t *testing.T) {
+	m, err := Read(bytes.NewReader(faceMap([]byte{0x1d, 0, 0, 0}, 1)), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lm := m.Faces[0].Lightmap
+	if lm == nil {
+		t.Fatal("no lightmap")
+	}
+
+	if lm.Width != 3 || lm.Height != 3 || lm.Mins != [2]int{0, 0} || len(lm.Styles) != 2 || lm.Styles[1] != 1 {
+		t.Fatalf("bad lightmap %+v", lm)
+	}
+
+	if len(lm.Images) != 2 {
+		t.Fatalf("expected 2 images, got %d", len(lm.Images))
+	}
+
+	if g := lm.Images[1].(*image.Gray).GrayAt(2, 1).Y; g != 9+5 {
+		t.Errorf("bad sample %d", g)
+	}
+
+	for _, v := range m.Faces[0].Verts {
+		if v.Pos == (Vector3{32, 16, 0}) && v.LightmapCoord != [2]float64{40.0 / 48, 32.0 / 48} {
+			t.Errorf("bad lightmap coords %v", v.LightmapCoord)
+		}
+	}
+
+	if m, err = Read(bytes.NewReader(faceMap([]byte{0x1d, 0, 0, 0}, 1)), NoLightmaps); err != nil {
+		t.Fatal(err)
+	} else if m.Faces[0].Lightmap != nil {
+		t.Error("lightmap read with NoLightmaps")
+	}
+
+	lit := []byte("QLIT\x01\x00\x00\x00")
+	for i := 0; i < 18*3; i++ {
+		lit = append(lit, uint8(i))
+	}
+
+	fsys := fstest.MapFS{
+		"maps/start.bsp": {Data: faceMap([]byte{0x1d, 0, 0, 0}, 1)},
+		"maps/start.lit": {Data: lit},
+	}
+
+	if m, err = Open(fsys, "maps/start.bsp", 0); err != nil {
+		t.Fatal(err)
+	}
+
+	rgba, ok := m.Faces[0].Lightmap.Images[1].(*image.RGBA)
+	if !ok {
+		t.Fatalf("lit lightmap is %T", m.Faces[0].Lightmap.Images[1])
+	}
+
+	if c := rgba.RGBAAt(2, 1); c.R != 14*3 || c.G != 14*3+1 || c.B != 14*3+2 || c.A != 0xff {
+		t.Errorf("bad lit sample %v", c)
+	}
+}
+
+func TestRGBLightmaps(t *testing.T) {
+	// Quake2 map with the same face as faceMap
+	lumps := make([][]byte, q2NumLumps)
+	lumps[q2LumpPlanes] = le(q1Plane{N: [3]float32{0, 0, 1}, T: PlaneAxialZ})
+	lumps[q2LumpVertices] = le([][3]float32{{0, 0, 0}, {32, 0, 0}, {32, 16, 0}, {0, 16, 0}})
+	lumps[q2LumpTextureInformation] = le(q2TexInfo{S: [3]float32{1, 0, 0}, T: [3]float32{0, 1, 0}, Dt: 8, Next: 0xffffffff})
+	lumps[q2LumpEdges] = le([]q1EdgeIndex{{}, {0, 1}, {1, 2}, {2, 3}, {3, 0}})
+	lumps[q2LumpFaceEdgeTables] = le([]int32{1, 2, 3, 4})
+	lumps[q2LumpFaces] = le(q2Face{NumEdges: 4, Styles: [4]uint8{0, 1, 255, 255}, LightMap: 3})
+	for i := 0; i < 3+18*3; i++ {
+		lumps[q2LumpLightmaps] = append(lumps[q2LumpLightmaps], uint8(i))
+	}
+
+	for name, b := range map[string][]byte{
+		"hl": faceMap([]byte{0x1e, 0, 0, 0}, 3),
+		"q2": buildBSP([]byte{'I', 'B', 'S', 'P', 0x26, 0, 0, 0}, lumps),
+	} {
+		m, err := Read(bytes.NewReader(b), 0)
+		if err != nil {
+			t.Fatal(name, err)
+		}
+
+		lm := m.Faces[0].Lightmap
+		if lm == nil || lm.Width != 3 || lm.Height != 3 || len(lm.Images) != 2 {
+			t.Fatalf("%s: bad lightmap %+v", name, lm)
+		}
+
+		base := uint8(0)
+		if name == "q2" {
+			base = 3
+		}
+
+		if c := lm.Images[1].(*image.RGBA).RGBAAt(2, 1); c.R != base+14*3 || c.G != base+14*3+1 || c.B != base+14*3+2 {
+			t.Errorf("%s: bad sample %v", name, c)
+		}
+
+		for _, v := range m.Faces[0].Verts {
+			if v.Pos == (Vector3{0, 0, 0}) && v.LightmapCoord != [2]float64{8.0 / 48, 16.0 / 48} {
+				t.Errorf("%s: bad lightmap coords %v", name, v.LightmapCoord)
+			}
+		}
+
+		// a .lit file is for Quake maps only
+		fsys := fstest.MapFS{
+			"maps/start.bsp": {Data: b},
+			"maps/start.lit": {Data: append([]byte("QLIT\x01\x00\x00\x00"), bytes.Repeat([]byte{0xff}, 18*3)...)},
+		}
+
+		if m, err = Open(fsys, "maps/start.bsp", 0); err != nil {
+			t.Fatal(name, err)
+		} else if m.Lit != nil {
+			t.Errorf("%s: lit loaded", name)
+		}
+
+		if c := m.Faces[0].Lightmap.Images[1].(*image.RGBA).RGBAAt(2, 1); c.R != base+14*3 {
+			t.Errorf("%s: lit applied, sample %v", name, c)
+		}
+	}
+}
+
+func q3LightmapMap() []byte {
+	return q3FaceMap(q3Face{Type: q3FacePolygon, NumVerts: 3, NumMeshVerts: 3, LightMap: 0, Texture: 1, Effect: 0xffffffff, Normal: [3]float32{0, 0, 1}})
+}
+
+// q3FaceMap returns a Quake3 map of a single face with three vertices and
+// three mesh vertices.
+func q3FaceMap(face q3Face) []byte {
+	lumps := make([][]byte, q3NumLumps)
+	lumps[q3LumpVertices] = le([]q3Vertex{
+		{Position: [3]float32{0, 0, 0}, LightMapCoords: [2]float32{0, 0}, Color: [4]uint8{10, 20, 30, 255}},
+		{Position: [3]float32{64, 0, 0}, SurfCoords: [2]float32{1, -0.5}, LightMapCoords: [2]float32{0.5, 0}, Color: [4]uint8{100, 50, 0, 128}},
+		{Position: [3]float32{0, 64, 0}, LightMapCoords: [2]float32{0, 0.5}, Color: [4]uint8{0, 0, 0, 255}},
+	})
+	lumps[q3LumpMeshVertices] = le([]uint32{0, 1, 2})
+	lumps[q3LumpFaces] = le(face)
+
+	var sky, floor, fog [64]byte
+	copy(sky[:], "textures/skies/blue")
+	copy(floor[:], "textures/base_floor/clang_floor")
+	copy(fog[:], "textures/sfx/fog")
+	lumps[q3LumpTextureInformation] = le(
+		q3TexInfo{Name: sky, SurFlags: Q3SurfSky | Q3SurfNoImpact},
+		q3TexInfo{Name: floor, Contents: Q3ContentsSolid},
+	)
+	lumps[q3LumpEffects] = le(q3Effect{Name: fog, Brush: 3, Side: 0xffffffff})
+
+	page := make([]byte, Q3LightmapSize*Q3LightmapSize*3)
+	copy(page[3:], []byte{40, 80, 120})
+	lumps[q3LumpLightmaps] = page
+
+	return buildBSP([]byte{'I', 'B', 'S', 'P', 0x2e, 0, 0, 0}, lumps)
+}
+
+func TestQ3Lightmaps(t *testing.T) {
+	m, err := Read(bytes.NewReader(q3LightmapMap()), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(m.LightmapPages) != 1 || m.Faces[0].LightmapPage != 0 {
+		t.Fatalf("bad lightmap pages %d, face page %d", len(m.LightmapPages), m.Faces[0].LightmapPage)
+	}
+
+	if c := m.LightmapPages[0].RGBAAt(1, 0); c != (color.RGBA{40, 80, 120, 255}) {
+		t.Errorf("bad lightmap sample %v", c)
+	}
+
+	v := m.Faces[0].Verts[1]
+	if v.LightmapCoord != [2]float64{0.5, 0} || v.Color != (color.NRGBA{100, 50, 0, 128}) || v.TexCoord != [2]float64{1, -0.5} {
+		t.Errorf("bad vertex %+v", v)
+	}
+
+	m, err = ReadWith(bytes.NewReader(q3LightmapMap()), 0, Options{Q3OverbrightBits: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if c := m.LightmapPages[0].RGBAAt(1, 0); c != (color.RGBA{85, 170, 255, 255}) {
+		t.Errorf("bad overbright sample %v", c)
+	}
+
+	if c := m.Faces[0].Verts[0].Color; c != (color.NRGBA{40, 80, 120, 255}) {
+		t.Errorf("bad overbright vertex colour %v", c)
+	}
+
+	if m, err = Read(bytes.NewReader(q3LightmapMap()), NoLightmaps); err != nil {
+		t.Fatal(err)
+	} else if m.LightmapPages != nil || m.Faces[0].LightmapPage != -1 {
+		t.Error("lightmaps read with NoLightmaps")
+	}
+}
+
+func TestTexCoords(t *testing.T) {
+	check := func(name string, m *Model, want [2]float64) {
+		for _, v := range m.Faces[0].Verts {
+			if v.Pos == (Vector3{32, 16, 0}) && v.TexCoord != want {
+				t.Errorf("%s: expected %v, got %v", name, want, v.TexCoord)
+			}
+		}
+	}
+
+	for _, id := range [][]byte{{0x1d, 0, 0, 0}, {0x1e, 0, 0, 0}} {
+		m, err := Read(bytes.NewReader(faceMap(id, 1)), NoLightmaps)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if tex := m.Faces[0].TexInfo.Texture; tex.Width != 16 || tex.Height != 8 {
+			t.Errorf("bad texture size %dx%d", tex.Width, tex.Height)
+		}
+
+		if m.Faces[0].TexInfo.Dt != 8 {
+			t.Errorf("bad Dt %v", m.Faces[0].TexInfo.Dt)
+		}
+
+		check(fmt.Sprintf("%x", id[0]), m, [2]float64{2, 3})
+	}
+
+	lumps := make([][]byte, q2NumLumps)
+	lumps[q2LumpPlanes] = le(q1Plane{N: [3]float32{0, 0, 1}, T: PlaneAxialZ})
+	lumps[q2LumpVertices] = le([][3]float32{{0, 0, 0}, {32, 0, 0}, {32, 16, 0}, {0, 16, 0}})
+	lumps[q2LumpTextureInformation] = le(
+		q2TexInfo{S: [3]float32{1, 0, 0}, T: [3]float32{0, 1, 0}, Dt: 8, Texture: [32]byte{'a'}, Next: 0xffffffff},
+		q2TexInfo{Texture: [32]byte{'b'}, Next: 0xffffffff},
+		q2TexInfo{S: [3]float32{1, 0, 0}, T: [3]float32{0, 1, 0}, Dt: 8, Texture: [32]byte{'c'}, Next: 0xffffffff},
+	)
+	lumps[q2LumpEdges] = le([]q1EdgeIndex{{}, {0, 1}, {1, 2}, {2, 3}, {3, 0}})
+	lumps[q2LumpFaceEdgeTables] = le([]int32{1, 2, 3, 4})
+	lumps[q2LumpFaces] = le(q2Face{NumEdges: 4, TexInfoID: 2, LightMap: 0xffffffff})
+
+	m, err := Read(bytes.NewReader(buildBSP([]byte{'I', 'B', 'S', 'P', 0x26, 0, 0, 0}, lumps)), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tex := m.Faces[0].TexInfo.Texture
+	if tex != &m.Textures[2] || tex.Name != "c" {
+		t.Fatalf("face texture does not point into Model.Textures")
+	}
+
+	check("q2", m, [2]float64{0, 0})
+	m.SetTextureSize(tex, 16, 8)
+	check("q2", m, [2]float64{2, 3})
+}
+
+func TestTriangles(t *testing.T) {
+	m, err := Read(bytes.NewReader(faceMap([]byte{0x1d, 0, 0, 0}, 1)), NoLightmaps)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f := &m.Faces[0]
+	want := []Vector3{{0, 0, 0}, {32, 0, 0}, {32, 16, 0}, {0, 16, 0}}
+	if len(f.Verts) != len(want) {
+		t.Fatalf("expected %d vertices, got %d", len(want), len(f.Verts))
+	}
+
+	for i, v := range f.Verts {
+		if v.Pos != want[i] {
+			t.Errorf("vertex %d: expected %v, got %v", i, want[i], v.Pos)
+		}
+	}
+
+	if tris := f.Triangles(); !reflect.DeepEqual(tris, [][3]int{{0, 1, 2}, {0, 2, 3}}) {
+		t.Errorf("bad fan %v", tris)
+	}
+
+	if m, err = Read(bytes.NewReader(q3LightmapMap()), 0); err != nil {
+		t.Fatal(err)
+	}
+
+	if f = &m.Faces[0]; len(f.Verts) != 3 || !reflect.DeepEqual(f.Triangles(), [][3]int{{0, 1, 2}}) {
+		t.Errorf("bad Quake3 face %+v", f)
+	}
+}
+
+func TestQ3Faces(t *testing.T) {
+	m, err := Read(bytes.NewReader(q3LightmapMap()), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(m.Textures) != 2 || m.Textures[0].Name != "textures/skies/blue" {
+		t.Fatalf("bad textures %+v", m.Textures)
+	}
+
+	if len(m.Effects) != 1 || m.Effects[0] != (Effect{"textures/sfx/fog", 3, -1}) {
+		t.Errorf("bad effects %+v", m.Effects)
+	}
+
+	f := &m.Faces[0]
+	if f.TexInfo.Texture != &m.Textures[1] || f.TexInfo.Contents != Q3ContentsSolid || f.TexInfo.SurfaceFlags&Q3SurfSky != 0 {
+		t.Errorf("bad texinfo %+v", f.TexInfo)
+	}
+
+	if f.Effect != -1 || f.Normal != (Vector3{0, 0, 1}) || !f.Front {
+		t.Errorf("bad face %+v", f)
+	}
+
+	if f.Plane == nil || f.Plane.N != f.Normal || f.Plane.D != 0 {
+		t.Errorf("bad plane %+v", f.Plane)
+	}
+
+	if Q3ContentsAreaPortal != 0x8000 || Q3ContentsNoDrop != 0x80000000 || Q3SurfDust != 0x40000 {
+		t.Errorf("bad flag values")
+	}
+
+	if m, err = Read(bytes.NewReader(faceMap([]byte{0x1d, 0, 0, 0}, 1)), 0); err != nil {
+		t.Fatal(err)
+	} else if f = &m.Faces[0]; f.Normal != (Vector3{0, 0, 1}) || f.Effect != -1 {
+		t.Errorf("bad Quake face %+v", f)
+	}
+}
+
+func TestQ3BadFaces(t *testing.T) {
+	for _, f := range []q3Face{
+		{Type: q3FacePolygon, FirstVertex: 1, NumVerts: 3, NumMeshVerts: 3},
+		{Type: q3FaceMesh, FirstVertex: 1, NumVerts: 0xffffffff, NumMeshVerts: 3},
+		{Type: q3FacePolygon, NumVerts: 3, FirstMeshVert: 1, NumMeshVerts: 3},
+		{Type: q3FaceMesh, NumVerts: 3, FirstMeshVert: 2, NumMeshVerts: 0xffffffff},
+		{Type: q3FaceMesh, NumVerts: 2, NumMeshVerts: 3},
+	} {
+		if _, err := Read(bytes.NewReader(q3FaceMap(f)), 0); err != ErrFormat {
+			t.Errorf("%+v: expected ErrFormat, got %v", f, err)
+		}
+	}
+}
+
+// patchControls returns a 5x3 control grid of two pieces along X, bulging
+// up in the middle row.
+func patchControls(x0 float32) (ctrl []q3Vertex) {
+	for y := 0; y < 3; y++ {
+		for x := 0; x < 5; x++ {
+			v := q3Vertex{
+				Position:   [3]float32{x0 + float32(x)*16, float32(y) * 16, 0},
+				SurfCoords: [2]float32{float32(x) / 4, float32(y) / 2},
+				Normal:     [3]float32{0, 0, 1},
+				Color:      [4]uint8{uint8(x * 50), 0, 0, 255},
+			}
+			if y == 1 {
+				v.Position[2] = 16
+			}
+			ctrl = append(ctrl, v)
+		}
+	}
+
+	return
+}
+
+func TestQ3Patches(t *testing.T) {
+	lumps := make([][]byte, q3NumLumps)
+	lumps[q3LumpVertices] = le(patchControls(0), patchControls(64))
+
+	var flare [64]byte
+	copy(flare[:], "flareShader")
+	lumps[q3LumpTextureInformation] = le(q3TexInfo{Name: flare})
+	lumps[q3LumpFaces] = le(
+		q3Face{Type: q3FaceBillboard, Effect: 0xffffffff, LightMap: 0xffffffff, LightMapOrigin: [3]float32{1, 2, 3}, LightMapS: [3]float32{1, 0.5, 0}, Normal: [3]float32{0, -1, 0}},
+		q3Face{Type: q3FacePatch, NumVerts: 15, PatchW: 5, PatchH: 3, Effect: 0xffffffff, LightMap: 0xffffffff},
+		q3Face{Type: q3FacePatch, FirstVertex: 15, NumVerts: 15, PatchW: 5, PatchH: 3, Effect: 0xffffffff, LightMap: 0xffffffff},
+	)
+
+	m, err := ReadWith(bytes.NewReader(buildBSP([]byte{'I', 'B', 'S', 'P', 0x2e, 0, 0, 0}, lumps)), 0, Options{Q3PatchLevel: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(m.Faces) != 2 {
+		t.Fatalf("expected 2 faces, got %d", len(m.Faces))
+	}
+
+	if len(m.Flares) != 1 || m.Flares[0] != (Flare{Vector3{1, 2, 3}, Vector3{0, -1, 0}, Vector3{1, 0.5, 0}, "flareShader", -1}) {
+		t.Errorf("bad flares %+v", m.Flares)
+	}
+
+	f := &m.Faces[0]
+	if len(f.Verts) != 9*5 || len(f.Triangles()) != 8*4*2 || f.Plane != nil {
+		t.Fatalf("bad tessellation: %d verts, %d triangles", len(f.Verts), len(f.Triangles()))
+	}
+
+	for _, i := range f.Indices {
+		if i < 0 || i >= len(f.Verts) {
+			t.Fatalf("index %d out of range", i)
+		}
+	}
+
+	// the grid passes through the corners and bulges halfway up
+	if p := f.Verts[0].Pos; p != (Vector3{0, 0, 0}) {
+		t.Errorf("bad first vertex %v", p)
+	}
+	if p := f.Verts[len(f.Verts)-1].Pos; p != (Vector3{64, 32, 0}) {
+		t.Errorf("bad last vertex %v", p)
+	}
+
+	v := f.Verts[2*9+2]
+	if v.Pos != (Vector3{16, 16, 8}) || v.TexCoord != [2]float64{0.25, 0.5} || v.Normal != (Vector3{0, 0, 1}) || v.Color != (color.NRGBA{50, 0, 0, 255}) {
+		t.Errorf("bad middle vertex %+v", v)
+	}
+
+	// the shared edge is identical on both patches
+	g := &m.Faces[1]
+	for y := 0; y < 5; y++ {
+		if a, b := f.Verts[y*9+8].Pos, g.Verts[y*9].Pos; a != b {
+			t.Errorf("crack at row %d: %v != %v", y, a, b)
+		}
+	}
+
+	if m, err = Read(bytes.NewReader(buildBSP([]byte{'I', 'B', 'S', 'P', 0x2e, 0, 0, 0}, lumps)), 0); err != nil {
+		t.Fatal(err)
+	} else if n := len(m.Faces[0].Verts); n != 17*9 {
+		t.Errorf("expected %d verts by default, got %d", 17*9, n)
+	}
+
+	if _, _, err = q3Tessellate(make([]Vert, 12), 4, 3, 4); err != ErrFormat {
+		t.Errorf("even patch width accepted")
+	}
+}
+
+func TestTree(t *testing.T) {
+	for _, id := range [][]byte{{0x1d, 0, 0, 0}, {0x1e, 0, 0, 0}} {
+		m, err := Read(bytes.NewReader(faceMap(id, 1)), 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(m.Nodes) != 1 || len(m.Leaves) != 2 {
+			t.Fatalf("bad tree: %d nodes, %d leaves", len(m.Nodes), len(m.Leaves))
+		}
+
+		n := &m.Nodes[0]
+		if n.Plane != m.Faces[0].Plane || n.Children != [2]int{-2, -1} || n.Mins != (Vector3{0, 0, -16}) || n.NumFaces != 1 {
+			t.Errorf("bad node %+v", n)
+		}
+
+		l := &m.Leaves[1]
+		if l.Contents != Q1ContentsEmpty || l.VisOffset != 0 || l.Cluster != -1 || !reflect.DeepEqual(l.Faces, []int{0}) || l.Ambient != [4]uint8{0, 255, 0, 0} {
+			t.Errorf("bad leaf %+v", l)
+		}
+	}
+
+	// Quake2 map without faces
+	lumps := make([][]byte, q2NumLumps)
+	lumps[q2LumpPlanes] = le(q1Plane{N: [3]float32{1, 0, 0}, D: 8, T: PlaneAxialX})
+	lumps[q2LumpNodes] = le(q2Node{Children: [2]int32{-2, -1}})
+	lumps[q2LumpLeaves] = le(
+		q2Leaf{Contents: 1, Cluster: -1},
+		q2Leaf{Cluster: 3, Area: 1, Mins: [3]int16{8, -4, -4}, FirstLeafBrush: 1, NumLeafBrushes: 1},
+	)
+	lumps[q2LumpLeafBrushTable] = le([]uint16{1, 0})
+	lumps[q2LumpBrushes] = make([]byte, 2*12)
+
+	m, err := Read(bytes.NewReader(buildBSP([]byte{'I', 'B', 'S', 'P', 0x26, 0, 0, 0}, lumps)), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if l := &m.Leaves[1]; l.Cluster != 3 || l.Area != 1 || l.VisOffset != -1 || l.Mins != (Vector3{8, -4, -4}) || !reflect.DeepEqual(l.Brushes, []int{0}) {
+		t.Errorf("bad Quake2 leaf %+v", l)
+	}
+
+	if m.Nodes[0].Plane.D != 8 {
+		t.Errorf("bad Quake2 node %+v", m.Nodes[0])
+	}
+
+	// Quake3 map, leaf faces skip the billboard
+	lumps = make([][]byte, q3NumLumps)
+	lumps[q3LumpPlanes] = le(q3Plane{N: [3]float32{0, 1, 0}, D: -2})
+	lumps[q3LumpNodes] = le(q3Node{Children: [2]int32{-1, -2}, Maxs: [3]int32{1, 2, 3}})
+	lumps[q3LumpLeaves] = le(
+		q3Leaf{Cluster: 0, NumLeafFaces: 2},
+		q3Leaf{Cluster: -1},
+	)
+	lumps[q3LumpLeafFaceTable] = le([]int32{0, 1})
+	lumps[q3LumpFaces] = le(
+		q3Face{Type: q3FaceBillboard, Effect: 0xffffffff, LightMap: 0xffffffff},
+		q3Face{Type: q3FacePolygon, Effect: 0xffffffff, LightMap: 0xffffffff},
+	)
+
+	if m, err = Read(bytes.NewReader(buildBSP([]byte{'I', 'B', 'S', 'P', 0x2e, 0, 0, 0}, lumps)), 0); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := &m.Nodes[0]; n.Plane.N != (Vector3{0, 1, 0}) || n.Maxs != (Vector3{1, 2, 3}) || n.NumFaces != 0 {
+		t.Errorf("bad Quake3 node %+v", n)
+	}
+
+	if l := &m.Leaves[0]; !reflect.DeepEqual(l.Faces, []int{0}) || l.Cluster != 0 {
+		t.Errorf("bad Quake3 leaf %+v", l)
+	}
+
+	// out of range children
+	lumps[q3LumpNodes] = le(q3Node{Children: [2]int32{1, -1}})
+	if _, err = Read(bytes.NewReader(buildBSP([]byte{'I', 'B', 'S', 'P', 0x2e, 0, 0, 0}, lumps)), 0); err != ErrFormat {
+		t.Errorf("expected ErrFormat, got %v", err)
+	}
+}
+
+func TestVisibility(t *testing.T) {
+	if row, err := visDecompress([]byte{9, 5, 0, 3, 7}, 1, 5); err != nil || !bytes.Equal(row, []byte{5, 0, 0, 0, 7}) {
+		t.Errorf("bad row %v (%v)", row, err)
+	}
+
+	if _, err := visDecompress([]byte{5, 0}, 0, 5); err != ErrFormat {
+		t.Errorf("truncated row accepted")
+	}
+
+	// Quake, the face is seen from above only
+	m, err := Read(bytes.NewReader(faceMap([]byte{0x1d, 0, 0, 0}, 1)), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if m.PointLeaf(Vector3{16, 8, 8}) != 1 || m.PointLeaf(Vector3{16, 8, -8}) != 0 {
+		t.Errorf("bad point leaves")
+	}
+
+	if !m.CanSee(1, 1) || m.CanSee(1, 0) || m.CanSee(0, 1) {
+		t.Errorf("bad Quake visibility")
+	}
+
+	if f := m.VisibleFaces(Vector3{16, 8, 8}); !reflect.DeepEqual(f, []int{0}) {
+		t.Errorf("bad visible faces from above %v", f)
+	}
+
+	if f := m.VisibleFaces(Vector3{16, 8, -8}); f != nil {
+		t.Errorf("bad visible faces from below %v", f)
+	}
+
+	// Quake2, three clusters and a solid leaf
+	lumps := make([][]byte, q2NumLumps)
+	lumps[q2LumpLeaves] = le(
+		q2Leaf{Contents: 1, Cluster: -1},
+		q2Leaf{Cluster: 0},
+		q2Leaf{Cluster: 1},
+		q2Leaf{Cluster: 2},
+	)
+	lumps[q2LumpVisibility] = le(
+		uint32(3),
+		[6]uint32{28, 32, 29, 32, 30, 32},
+		[]byte{0x03, 0x07, 0x00, 0x01, 0x07},
+	)
+
+	q2 := buildBSP([]byte{'I', 'B', 'S', 'P', 0x26, 0, 0, 0}, lumps)
+	if m, err = Read(bytes.NewReader(q2), 0); err != nil {
+		t.Fatal(err)
+	}
+
+	if l := m.VisibleLeaves(1); !reflect.DeepEqual(l, []int{1, 2}) {
+		t.Errorf("bad leaves visible from cluster 0: %v", l)
+	}
+
+	if l := m.VisibleLeaves(3); l != nil {
+		t.Errorf("bad leaves visible from cluster 2: %v", l)
+	}
+
+	if !m.CanSee(2, 3) || m.CanSee(1, 0) || m.CanSee(0, 1) || !m.CanHear(3, 1) {
+		t.Errorf("bad Quake2 visibility")
+	}
+
+	if m, err = Read(bytes.NewReader(q2), NoVisibility); err != nil {
+		t.Fatal(err)
+	} else if m.PVS != nil || !m.CanSee(3, 1) {
+		t.Errorf("visibility read with NoVisibility")
+	}
+
+	// Quake3, uncompressed
+	lumps = make([][]byte, q3NumLumps)
+	lumps[q3LumpLeaves] = le(q3Leaf{Cluster: 0}, q3Leaf{Cluster: 1})
+	lumps[q3LumpVisibility] = le(uint32(2), uint32(1), []byte{0x01, 0x03})
+
+	if m, err = Read(bytes.NewReader(buildBSP([]byte{'I', 'B', 'S', 'P', 0x2e, 0, 0, 0}, lumps)), 0); err != nil {
+		t.Fatal(err)
+	}
+
+	if m.CanSee(0, 1) || !m.CanSee(1, 0) || !m.CanSee(1, 1) {
+		t.Errorf("bad Quake3 visibility")
+	}
+}
+
+func TestQ2Animations(t *testing.T) {
+	// enough textures for Model.Textures to grow a few times
+	var texInfos []q2TexInfo
+	for i := 0; i < 8; i++ {
+		ti := q2TexInfo{Next: 0xffffffff}
+		copy(ti.Texture[:], fmt.Sprintf("e1u1/wall%d", i))
+		texInfos = append(texInfos, ti)
+	}
+	for i, name := range []string{"e1u1/lava1", "e1u1/lava2", "e1u1/lava3"} {
+		ti := q2TexInfo{Next: uint32(8 + (i+1)%3)}
+		copy(ti.Texture[:], name)
+		texInfos = append(texInfos, ti)
+	}
+
+	lumps := make([][]byte, q2NumLumps)
+	lumps[q2LumpTextureInformation] = le(texInfos)
+
+	m, err := Read(bytes.NewReader(buildBSP([]byte{'I', 'B', 'S', 'P', 0x26, 0, 0, 0}, lumps)), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(m.Textures) != 11 || m.Textures[8].Next != &m.Textures[9] || m.Textures[10].Next != &m.Textures[8] {
+		t.Fatalf("bad texture chain")
+	}
+
+	anims := m.Animations()
+	if len(anims) != 1 || !reflect.DeepEqual(anims[0].Frames, []int{8, 9, 10}) {
+		t.Fatalf("bad animations %+v", anims)
+	}
+}
+
+func TestOpenLit(t *testing.T) {
+	lit := append([]byte("QLIT\x01\x00\x00\x00"), 10, 11, 12, 20, 21, 22, 30, 31, 32, 40, 41, 42)
+	fsys := fstest.MapFS{
+		"maps/start.bsp": {Data: q1TestMap()},
+		"maps/start.lit": {Data: lit},
+		"maps/e1m1.bsp":  {Data: q1TestMap()},
+	}
+
+	m, err := Open(fsys, "maps/start.bsp", 0)
+	if err != nil {
+		t.Fatal(err)
+	} else if m.Lit == nil {
+		t.Fatal("no lit loaded")
+	}
+
+	if s := m.Lit.Samples(1, 2); string(s) != "\x14\x15\x16\x1e\x1f\x20" {
+		t.Errorf("samples %v", s)
+	}
+
+	if s := m.Lit.Samples(3, 2); s != nil {
+		t.Errorf("out of range samples %v", s)
+	}
+
+	if m, err = Open(fsys, "maps/e1m1.bsp", 0); err != nil {
+		t.Fatal(err)
+	} else if m.Lit != nil {
+		t.Error("lit loaded out of nowhere")
+	}
+
+	if _, err = ReadLit(bytes.NewReader(lit[:6])); err != ErrLitFormat {
+		t.Errorf("got %v, want ErrLitFormat", err)
+	}
+}
@@ -216,15 +216,14 @@ func drawScene() {
 		g = gl.Ubyte(i>>1) + 100
 		b = gl.Ubyte(i>>2) + 100
 
-		if model.Triangle {
-			gl.Begin(gl.TRIANGLES)
-		} else {
-			gl.Begin(gl.LINES)
-		}
+		gl.Begin(gl.TRIANGLES)
 
 		gl.Color4ub(r, g, b, 0xff)
-		for _, v := range face.Verts {
-			gl.Vertex3d(gl.Double(v.Pos[0]), gl.Double(v.Pos[1]), gl.Double(v.Pos[2]))
+		for _, tri := range face.Triangles() {
+			for _, vi := range tri {
+				v := &face.Verts[vi]
+				gl.Vertex3d(gl.Double(v.Pos[0]), gl.Double(v.Pos[1]), gl.Double(v.Pos[2]))
+			}
 		}
 
 		gl.End()
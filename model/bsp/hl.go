@@ -15,7 +15,7 @@ type hlFace struct {
 	FirstEdge uint32
 	NumEdges  uint16
 	TexInfoID uint16
-	Light     [4]uint8
+	Styles    [4]uint8
 	LightMap  uint32
 }
 
@@ -66,21 +66,48 @@ func hlBSPRead(r io.Reader, flags int, m *Model) (err error) {
 		return
 	}
 
+	linkAnimations(m.Textures)
+
+	// planes
+	m.Planes, err = q1ReadPlanes(lumps[hlLumpPlanes].Data(hlHeaderLen, b))
+	if err != nil {
+		return
+	}
+
 	// faces
-	m.Faces, err = hlReadFaces(b, lumps, m)
+	m.Faces, err = hlReadFaces(b, lumps, flags, m)
 	if err != nil {
 		return
 	}
 
+	// BSP tree, same as in Quake
+	m.Nodes, err = q1ReadNodes(lumps[hlLumpNodes].Data(hlHeaderLen, b), m)
+	if err != nil {
+		return
+	}
+
+	m.Leaves, err = q1ReadLeaves(lumps[hlLumpLeaves].Data(hlHeaderLen, b), lumps[hlLumpMarkSurfaces].Data(hlHeaderLen, b), m)
+	if err != nil {
+		return
+	}
+
+	if err = m.checkTree(); err != nil {
+		return
+	}
+
+	// visibility
+	if flags&NoVisibility == 0 {
+		m.PVS, err = q1ReadVisibility(lumps[hlLumpVisibility].Data(hlHeaderLen, b), lumps[hlLumpModels].Data(hlHeaderLen, b), m)
+	}
+
 	return
 }
 
-func hlReadFaces(b []byte, lumps []bspLump, m *Model) (out []Face, err error) {
+func hlReadFaces(b []byte, lumps []bspLump, flags int, m *Model) (out []Face, err error) {
 	var (
 		edgeIndices []q1EdgeIndex
 		faceEdges   []int32
 		faces       []hlFace
-		planes      []Plane
 		texInfos    []q1TexInfo
 		verts       []Vector3
 	)
@@ -90,9 +117,7 @@ func hlReadFaces(b []byte, lumps []bspLump, m *Model) (out []Face, err error) {
 		data[i] = lumps[i].Data(hlHeaderLen, b)
 	}
 
-	if planes, err = q1ReadPlanes(data[hlLumpPlanes]); err != nil {
-		return
-	} else if verts, err = q1ReadVertices(data[hlLumpVertices]); err != nil {
+	if verts, err = q1ReadVertices(data[hlLumpVertices]); err != nil {
 		return
 	} else if texInfos, err = q1ReadTexInfo(data[hlLumpTextureInformation]); err != nil {
 		return
@@ -110,48 +135,65 @@ func hlReadFaces(b []byte, lumps []bspLump, m *Model) (out []Face, err error) {
 
 	out = make([]Face, 0, len(faces))
 	for _, face := range faces {
-		v := make([]Vert, 0, int(face.NumEdges)*2)
+		v := make([]Vert, 0, int(face.NumEdges))
 		fe := faceEdges[face.FirstEdge : int(face.FirstEdge)+int(face.NumEdges)]
 
+		// edges go around the face, the first vertex of each one makes
+		// the winding
 		for _, fei := range fe {
 			if fei < 0 {
 				v = append(v, Vert{
 					Pos: verts[edgeIndices[-fei].B],
 				})
-				v = append(v, Vert{
-					Pos: verts[edgeIndices[-fei].A],
-				})
 			} else {
 				v = append(v, Vert{
 					Pos: verts[edgeIndices[fei].A],
 				})
-				v = append(v, Vert{
-					Pos: verts[edgeIndices[fei].B],
-				})
 			}
 		}
 
 		ti := &texInfos[face.TexInfoID]
-		var flags TexFlags
+		var texFlags TexFlags
 		if ti.Anim != 0 {
-			flags |= TexAnimated
+			texFlags |= TexAnimated
 		}
 		s := qVector3(ti.S)
 		t := qVector3(ti.T)
 
+		lightOffset := -1
+		if face.LightMap != 0xffffffff {
+			lightOffset = int(face.LightMap)
+		}
+
 		out = append(out, Face{
 			Verts: v,
 			Front: face.Side == 0,
-			Plane: &planes[face.Plane],
+			Plane: &m.Planes[face.Plane],
 			TexInfo: TexInfo{
 				S:       s,
 				T:       t,
 				Ds:      float64(ti.Ds),
-				Dt:      float64(ti.Ds),
+				Dt:      float64(ti.Dt),
 				Texture: &m.Textures[ti.TexID],
-				Flags:   flags,
+				Flags:   texFlags,
 			},
+			Effect:       -1,
+			LightOffset:  lightOffset,
+			LightmapPage: -1,
 		})
+
+		f := &out[len(out)-1]
+		f.Normal = f.Plane.N
+		if !f.Front {
+			f.Normal = Vector3{-f.Normal[0], -f.Normal[1], -f.Normal[2]}
+		}
+		setTexCoords(f)
+
+		if lightOffset >= 0 && flags&NoLightmaps == 0 {
+			if f.Lightmap = newLightmap(v, &f.TexInfo, face.Styles); f.Lightmap != nil {
+				f.Lightmap.readRGB(data[hlLumpLightmaps], lightOffset)
+			}
+		}
 	}
 
 	return
@@ -188,6 +230,8 @@ func hlReadTextures(b []byte) (texs []Texture, err error) {
 			texs = append(texs, Texture{
 				Name:       hlt.Name,
 				DataSource: source,
+				Width:      hlt.Bounds().Dx(),
+				Height:     hlt.Bounds().Dy(),
 			})
 		}
 	}
@@ -0,0 +1,124 @@
+package bsp
+
+import (
+	"image"
+	"math"
+)
+
+// LuxelSize is the size of a lightmap sample in texture space units, for
+// Quake, Quake2 and Half-Life maps.
+const LuxelSize = 16
+
+// Lightmap is a lightmap of a face, with an image per light style. Images
+// are greyscale for Quake maps without a .lit file and RGB otherwise.
+type Lightmap struct {
+	Styles []uint8 // light style of each image
+	Mins   [2]int  // texture space mins, in luxels
+	Width  int     // in luxels
+	Height int     // in luxels
+	Images []image.Image
+}
+
+// lightStyles returns the styles in use, 255 marking the end.
+func lightStyles(styles [4]uint8) []uint8 {
+	n := 0
+	for n < len(styles) && styles[n] != 255 {
+		n++
+	}
+
+	return append([]uint8(nil), styles[:n]...)
+}
+
+// newLightmap computes lightmap extents of a face from its texture space
+// bounds and sets lightmap coordinates of its vertices.
+func newLightmap(verts []Vert, ti *TexInfo, styles [4]uint8) *Lightmap {
+	if len(verts) == 0 {
+		return nil
+	}
+
+	mins := [2]float64{math.Inf(1), math.Inf(1)}
+	maxs := [2]float64{math.Inf(-1), math.Inf(-1)}
+	for _, v := range verts {
+		st := texCoords(v.Pos, ti)
+		for j := range st {
+			mins[j] = math.Min(mins[j], st[j])
+			maxs[j] = math.Max(maxs[j], st[j])
+		}
+	}
+
+	lm := &Lightmap{
+		Styles: lightStyles(styles),
+	}
+
+	var size [2]int
+	for j := range size {
+		bmin := int(math.Floor(mins[j] / LuxelSize))
+		bmax := int(math.Ceil(maxs[j] / LuxelSize))
+		lm.Mins[j] = bmin
+		size[j] = bmax - bmin + 1
+	}
+	lm.Width, lm.Height = size[0], size[1]
+
+	for i := range verts {
+		st := texCoords(verts[i].Pos, ti)
+		for j := range st {
+			verts[i].LightmapCoord[j] = (st[j] - float64(lm.Mins[j]*LuxelSize) + LuxelSize/2) / float64(size[j]*LuxelSize)
+		}
+	}
+
+	return lm
+}
+
+// texCoords returns texture space coordinates of a point.
+func texCoords(p Vector3, ti *TexInfo) [2]float64 {
+	return [2]float64{
+		p[0]*ti.S[0] + p[1]*ti.S[1] + p[2]*ti.S[2] + ti.Ds,
+		p[0]*ti.T[0] + p[1]*ti.T[1] + p[2]*ti.T[2] + ti.Dt,
+	}
+}
+
+// size returns the number of samples of a single style.
+func (lm *Lightmap) size() int {
+	return lm.Width * lm.Height
+}
+
+// readGray sets greyscale images of all styles from the lightmap lump.
+// Images are left unset if the data is out of range.
+func (lm *Lightmap) readGray(b []byte, offset int) {
+	n := lm.size()
+	if offset < 0 || offset+n*len(lm.Styles) > len(b) {
+		return
+	}
+
+	lm.Images = make([]image.Image, len(lm.Styles))
+	for i := range lm.Images {
+		o := offset + i*n
+		lm.Images[i] = &image.Gray{
+			Pix:    b[o : o+n : o+n],
+			Stride: lm.Width,
+			Rect:   image.Rect(0, 0, lm.Width, lm.Height),
+		}
+	}
+}
+
+// readRGB sets RGB images of all styles from three bytes per sample.
+// Images are left unset if the data is out of range.
+func (lm *Lightmap) readRGB(b []byte, offset int) {
+	n := lm.size()
+	if offset < 0 || offset+n*3*len(lm.Styles) > len(b) {
+		return
+	}
+
+	lm.Images = make([]image.Image, len(lm.Styles))
+	for i := range lm.Images {
+		im := image.NewRGBA(image.Rect(0, 0, lm.Width, lm.Height))
+		src := b[offset+i*n*3:]
+		for j := 0; j < n; j++ {
+			im.Pix[j*4+0] = src[j*3+0]
+			im.Pix[j*4+1] = src[j*3+1]
+			im.Pix[j*4+2] = src[j*3+2]
+			im.Pix[j*4+3] = 0xff
+		}
+		lm.Images[i] = im
+	}
+}
@@ -0,0 +1,101 @@
+package bsp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"strings"
+)
+
+// Lit holds a colored lightmap of a Quake map, shipped by mods next to the
+// map as maps/<name>.lit. It replaces the greyscale lightmap lump of the map
+// with three bytes (RGB) for every byte of it.
+type Lit struct {
+	Data []byte
+}
+
+const litHeaderLen = 8
+
+var (
+	ErrLitFormat = errors.New("bsp: invalid lit format")
+)
+
+// ReadLit reads a .lit file.
+func ReadLit(r io.Reader) (lit *Lit, err error) {
+	var b []byte
+	if b, err = ioutil.ReadAll(r); err != nil {
+		return
+	}
+
+	if len(b) < litHeaderLen || !bytes.Equal(b[:4], []byte("QLIT")) || binary.LittleEndian.Uint32(b[4:]) != 1 {
+		err = ErrLitFormat
+		return
+	}
+
+	lit = &Lit{
+		Data: b[litHeaderLen:],
+	}
+
+	return
+}
+
+// Samples returns n RGB samples of the lightmap starting at offset, as found
+// in Face.LightOffset of a Quake map. Nil is returned if the data is out of
+// range.
+func (l *Lit) Samples(offset, n int) []byte {
+	if offset < 0 || n < 0 || (offset+n)*3 > len(l.Data) {
+		return nil
+	}
+
+	return l.Data[offset*3 : (offset+n)*3]
+}
+
+// Open reads a map from fsys (a directory, a pak archive or anything else
+// implementing fs.FS). For Quake maps a .lit file next to the map is read as
+// well and set as Model.Lit if there is one, face lightmaps becoming RGB.
+// Other formats have coloured lightmaps already and are left as they are.
+func Open(fsys fs.FS, name string, flags int) (m *Model, err error) {
+	return OpenWith(fsys, name, flags, Options{})
+}
+
+// OpenWith is like Open, reading the map with the given options.
+func OpenWith(fsys fs.FS, name string, flags int, opts Options) (m *Model, err error) {
+	var f fs.File
+	if f, err = fsys.Open(name); err != nil {
+		return
+	}
+
+	m, err = ReadWith(f, flags, opts)
+	f.Close()
+	if err != nil || flags&(EntitiesOnly|NoLightmaps) != 0 || !m.litable {
+		return
+	}
+
+	litName := strings.TrimSuffix(name, ".bsp") + ".lit"
+	if f, err = fsys.Open(litName); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			err = nil
+		}
+		return
+	}
+	defer f.Close()
+
+	if m.Lit, err = ReadLit(f); err == nil {
+		m.applyLit()
+	}
+
+	return
+}
+
+// applyLit replaces greyscale face lightmaps with coloured ones of m.Lit.
+func (m *Model) applyLit() {
+	for i := range m.Faces {
+		f := &m.Faces[i]
+		if f.Lightmap != nil {
+			f.Lightmap.readRGB(m.Lit.Data, f.LightOffset*3)
+		}
+	}
+}
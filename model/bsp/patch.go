@@ -0,0 +1,97 @@
+package bsp
+
+import (
+	"image/color"
+	"math"
+)
+
+// q3PatchLevel is the default of Options.Q3PatchLevel.
+const q3PatchLevel = 8
+
+// q3Tessellate tessellates a biquadratic patch of width*height control
+// points into a grid of vertices and a triangle list into it, every piece
+// split into level segments along each direction.
+func q3Tessellate(ctrl []Vert, width, height, level int) (verts []Vert, indices []int, err error) {
+	if width < 3 || height < 3 || width%2 == 0 || height%2 == 0 || len(ctrl) < width*height {
+		err = ErrFormat
+		return
+	}
+
+	if level < 1 {
+		level = q3PatchLevel
+	}
+
+	pw, ph := (width-1)/2, (height-1)/2
+	gw, gh := pw*level+1, ph*level+1
+
+	verts = make([]Vert, 0, gw*gh)
+	for y := 0; y < gh; y++ {
+		py := min(y/level, ph-1)
+		t := float64(y-py*level) / float64(level)
+
+		for x := 0; x < gw; x++ {
+			px := min(x/level, pw-1)
+			s := float64(x-px*level) / float64(level)
+
+			var piece [3][3]*Vert
+			for j := range piece {
+				for i := range piece[j] {
+					piece[j][i] = &ctrl[(py*2+j)*width+px*2+i]
+				}
+			}
+
+			verts = append(verts, q3PatchPoint(&piece, s, t))
+		}
+	}
+
+	indices = make([]int, 0, (gw-1)*(gh-1)*6)
+	for y := 0; y < gh-1; y++ {
+		for x := 0; x < gw-1; x++ {
+			a := y*gw + x
+			b, c := a+1, a+gw
+			indices = append(indices, a, c, b, b, c, c+1)
+		}
+	}
+
+	return
+}
+
+// q3PatchPoint evaluates a quadratic piece of a patch at (s, t).
+func q3PatchPoint(piece *[3][3]*Vert, s, t float64) (v Vert) {
+	bs := [3]float64{(1 - s) * (1 - s), 2 * s * (1 - s), s * s}
+	bt := [3]float64{(1 - t) * (1 - t), 2 * t * (1 - t), t * t}
+
+	var c [4]float64
+	for j := range piece {
+		for i, p := range piece[j] {
+			w := bs[i] * bt[j]
+			for k := 0; k < 3; k++ {
+				v.Pos[k] += w * p.Pos[k]
+				v.Normal[k] += w * p.Normal[k]
+			}
+			for k := 0; k < 2; k++ {
+				v.TexCoord[k] += w * p.TexCoord[k]
+				v.LightmapCoord[k] += w * p.LightmapCoord[k]
+			}
+			c[0] += w * float64(p.Color.R)
+			c[1] += w * float64(p.Color.G)
+			c[2] += w * float64(p.Color.B)
+			c[3] += w * float64(p.Color.A)
+		}
+	}
+
+	if l := math.Sqrt(v.Normal[0]*v.Normal[0] + v.Normal[1]*v.Normal[1] + v.Normal[2]*v.Normal[2]); l > 0 {
+		for k := range v.Normal {
+			v.Normal[k] /= l
+		}
+	}
+
+	v.Color = color.NRGBA{
+		uint8(math.Round(c[0])),
+		uint8(math.Round(c[1])),
+		uint8(math.Round(c[2])),
+		uint8(math.Round(c[3])),
+	}
+
+	return
+}
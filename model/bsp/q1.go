@@ -20,12 +20,29 @@ type q1Face struct {
 	FirstEdge uint32
 	NumEdges  uint16
 	TexInfoID uint16
-	LightType uint8
-	LightBase uint8
-	Light     [2]uint8
+	Styles    [4]uint8
 	LightMap  uint32
 }
 
+type q1Leaf struct {
+	Contents         int32
+	VisOffset        int32
+	Mins             [3]int16
+	Maxs             [3]int16
+	FirstMarkSurface uint16
+	NumMarkSurfaces  uint16
+	Ambient          [4]uint8
+}
+
+type q1Node struct {
+	Plane     uint32
+	Children  [2]int16
+	Mins      [3]int16
+	Maxs      [3]int16
+	FirstFace uint16
+	NumFaces  uint16
+}
+
 type q1Plane struct {
 	N [3]float32
 	D float32
@@ -75,6 +92,7 @@ func q1BSPRead(r io.Reader, flags int, m *Model) (err error) {
 	}
 
 	lumps := bspLumpsFrom(b, q1NumLumps)
+	m.litable = true
 
 	// entities
 	m.Entities, err = bspReadEntities(lumps[q1LumpEntities].Data(q1HeaderLen, b))
@@ -88,12 +106,40 @@ func q1BSPRead(r io.Reader, flags int, m *Model) (err error) {
 		return
 	}
 
+	linkAnimations(m.Textures)
+
+	// planes
+	m.Planes, err = q1ReadPlanes(lumps[q1LumpPlanes].Data(q1HeaderLen, b))
+	if err != nil {
+		return
+	}
+
 	// faces
-	m.Faces, err = q1ReadFaces(b, lumps, m)
+	m.Faces, err = q1ReadFaces(b, lumps, flags, m)
 	if err != nil {
 		return
 	}
 
+	// BSP tree
+	m.Nodes, err = q1ReadNodes(lumps[q1LumpNodes].Data(q1HeaderLen, b), m)
+	if err != nil {
+		return
+	}
+
+	m.Leaves, err = q1ReadLeaves(lumps[q1LumpLeaves].Data(q1HeaderLen, b), lumps[q1LumpMarkSurfaces].Data(q1HeaderLen, b), m)
+	if err != nil {
+		return
+	}
+
+	if err = m.checkTree(); err != nil {
+		return
+	}
+
+	// visibility
+	if flags&NoVisibility == 0 {
+		m.PVS, err = q1ReadVisibility(lumps[q1LumpVisibility].Data(q1HeaderLen, b), lumps[q1LumpModels].Data(q1HeaderLen, b), m)
+	}
+
 	return
 }
 
@@ -116,6 +162,99 @@ func q1ReadPlanes(b []byte) (planes []Plane, err error) {
 	return
 }
 
+func q1ReadNodes(b []byte, m *Model) (nodes []Node, err error) {
+	h := sliceHeader(&b)
+	h.Len = len(b) / 24
+	h.Cap = h.Len
+	nodes16 := *(*[]q1Node)(unsafe.Pointer(&h))
+	nodes = make([]Node, 0, len(nodes16))
+
+	for _, n := range nodes16 {
+		if int(n.Plane) >= len(m.Planes) || int(n.FirstFace)+int(n.NumFaces) > len(m.Faces) {
+			err = ErrFormat
+			return
+		}
+
+		nodes = append(nodes, Node{
+			Plane:     &m.Planes[n.Plane],
+			Children:  [2]int{int(n.Children[0]), int(n.Children[1])},
+			Mins:      sVector3(n.Mins),
+			Maxs:      sVector3(n.Maxs),
+			FirstFace: int(n.FirstFace),
+			NumFaces:  int(n.NumFaces),
+		})
+	}
+
+	return
+}
+
+func q1ReadLeaves(b, marks []byte, m *Model) (leaves []Leaf, err error) {
+	h := sliceHeader(&b)
+	h.Len = len(b) / 28
+	h.Cap = h.Len
+	leaves16 := *(*[]q1Leaf)(unsafe.Pointer(&h))
+	leaves = make([]Leaf, 0, len(leaves16))
+	markSurfaces := q1ReadShorts(marks)
+
+	for _, l := range leaves16 {
+		var faces []int
+		if faces, err = leafList(markSurfaces, int(l.FirstMarkSurface), int(l.NumMarkSurfaces), len(m.Faces), nil); err != nil {
+			return
+		}
+
+		leaves = append(leaves, Leaf{
+			Contents:  int(l.Contents),
+			Cluster:   -1,
+			VisOffset: int(l.VisOffset),
+			Mins:      sVector3(l.Mins),
+			Maxs:      sVector3(l.Maxs),
+			Faces:     faces,
+			Ambient:   l.Ambient,
+		})
+	}
+
+	return
+}
+
+// q1ReadVisibility decompresses rows of leaves of the world, which number
+// is taken from the first model.
+func q1ReadVisibility(b, models []byte, m *Model) (rows [][]byte, err error) {
+	if len(b) == 0 {
+		return
+	}
+
+	visLeaves := len(m.Leaves) - 1
+	if len(models) >= 64 {
+		visLeaves = int(int32(Uint32(models[52:])))
+	}
+
+	rows = make([][]byte, len(m.Leaves))
+	for i := 1; i < len(m.Leaves) && i <= visLeaves; i++ {
+		if offset := m.Leaves[i].VisOffset; offset >= 0 {
+			if rows[i], err = visDecompress(b, offset, (visLeaves+7)/8); err != nil {
+				return
+			}
+		}
+	}
+
+	return
+}
+
+// q1ReadShorts reads a table of unsigned shorts, such as mark surfaces.
+func q1ReadShorts(b []byte) (table []int) {
+	h := sliceHeader(&b)
+	h.Len = len(b) / 2
+	h.Cap = h.Len
+	shorts := *(*[]uint16)(unsafe.Pointer(&h))
+	table = make([]int, 0, len(shorts))
+
+	for _, s := range shorts {
+		table = append(table, int(s))
+	}
+
+	return
+}
+
 func q1ReadEdgeIndices(b []byte) (edgeIndices []q1EdgeIndex, err error) {
 	h := sliceHeader(&b)
 	h.Len = len(b) / 4
@@ -154,12 +293,11 @@ func q1ReadTexInfo(b []byte) (texInfos []q1TexInfo, err error) {
 	return
 }
 
-func q1ReadFaces(b []byte, lumps []bspLump, m *Model) (out []Face, err error) {
+func q1ReadFaces(b []byte, lumps []bspLump, flags int, m *Model) (out []Face, err error) {
 	var (
 		edgeIndices []q1EdgeIndex
 		faceEdges   []int32
 		faces       []q1Face
-		planes      []Plane
 		texInfos    []q1TexInfo
 		verts       []Vector3
 	)
@@ -169,9 +307,7 @@ func q1ReadFaces(b []byte, lumps []bspLump, m *Model) (out []Face, err error) {
 		data[i] = lumps[i].Data(q1HeaderLen, b)
 	}
 
-	if planes, err = q1ReadPlanes(data[q1LumpPlanes]); err != nil {
-		return
-	} else if verts, err = q1ReadVertices(data[q1LumpVertices]); err != nil {
+	if verts, err = q1ReadVertices(data[q1LumpVertices]); err != nil {
 		return
 	} else if texInfos, err = q1ReadTexInfo(data[q1LumpTextureInformation]); err != nil {
 		return
@@ -189,48 +325,65 @@ func q1ReadFaces(b []byte, lumps []bspLump, m *Model) (out []Face, err error) {
 
 	out = make([]Face, 0, len(faces))
 	for _, face := range faces {
-		v := make([]Vert, 0, int(face.NumEdges)*2)
+		v := make([]Vert, 0, int(face.NumEdges))
 		fe := faceEdges[face.FirstEdge : int(face.FirstEdge)+int(face.NumEdges)]
 
+		// edges go around the face, the first vertex of each one makes
+		// the winding
 		for _, fei := range fe {
 			if fei < 0 {
 				v = append(v, Vert{
 					Pos: verts[edgeIndices[-fei].B],
 				})
-				v = append(v, Vert{
-					Pos: verts[edgeIndices[-fei].A],
-				})
 			} else {
 				v = append(v, Vert{
 					Pos: verts[edgeIndices[fei].A],
 				})
-				v = append(v, Vert{
-					Pos: verts[edgeIndices[fei].B],
-				})
 			}
 		}
 
 		ti := &texInfos[face.TexInfoID]
-		var flags TexFlags
+		var texFlags TexFlags
 		if ti.Anim != 0 {
-			flags |= TexAnimated
+			texFlags |= TexAnimated
 		}
 		s := qVector3(ti.S)
 		t := qVector3(ti.T)
 
+		lightOffset := -1
+		if face.LightMap != 0xffffffff {
+			lightOffset = int(face.LightMap)
+		}
+
 		out = append(out, Face{
 			Verts: v,
 			Front: face.Side == 0,
-			Plane: &planes[face.Plane],
+			Plane: &m.Planes[face.Plane],
 			TexInfo: TexInfo{
 				S:       s,
 				T:       t,
 				Ds:      float64(ti.Ds),
-				Dt:      float64(ti.Ds),
+				Dt:      float64(ti.Dt),
 				Texture: &m.Textures[ti.TexID],
-				Flags:   flags,
+				Flags:   texFlags,
 			},
+			Effect:       -1,
+			LightOffset:  lightOffset,
+			LightmapPage: -1,
 		})
+
+		f := &out[len(out)-1]
+		f.Normal = f.Plane.N
+		if !f.Front {
+			f.Normal = Vector3{-f.Normal[0], -f.Normal[1], -f.Normal[2]}
+		}
+		setTexCoords(f)
+
+		if lightOffset >= 0 && flags&NoLightmaps == 0 {
+			if f.Lightmap = newLightmap(v, &f.TexInfo, face.Styles); f.Lightmap != nil {
+				f.Lightmap.readGray(data[q1LumpLightmaps], lightOffset)
+			}
+		}
 	}
 
 	return
@@ -261,7 +414,9 @@ func q1ReadTextures(b []byte) (texs []Texture, err error) {
 		width := int(Uint32(h[16:]))
 		height := int(Uint32(h[20:]))
 		texs = append(texs, Texture{
-			Name: string(bytes.ToLower(h[:nameLen])),
+			Name:   string(bytes.ToLower(h[:nameLen])),
+			Width:  width,
+			Height: height,
 			DataSource: dataSourceInternal{
 				&image.Paletted{
 					Pix:     h[dataOffset : dataOffset+width*height],
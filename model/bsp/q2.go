@@ -8,23 +8,34 @@ import (
 )
 
 type q2Face struct {
-	Plane          uint16
-	Side           uint16
-	FirstEdge      uint32
-	NumEdges       uint16
-	TexInfoID      uint16
-	LightMapStyles [4]uint8
-	LightMap       uint32
+	Plane     uint16
+	Side      uint16
+	FirstEdge uint32
+	NumEdges  uint16
+	TexInfoID uint16
+	Styles    [4]uint8
+	LightMap  uint32
+}
+
+type q2Leaf struct {
+	Contents       uint32
+	Cluster        int16
+	Area           int16
+	Mins           [3]int16
+	Maxs           [3]int16
+	FirstLeafFace  uint16
+	NumLeafFaces   uint16
+	FirstLeafBrush uint16
+	NumLeafBrushes uint16
 }
 
 type q2Node struct {
-	Plane      uint32
-	FrontChild int32
-	BackChild  int32
-	BBoxMin    [3]uint16
-	BBoxMax    [3]uint16
-	FirstFace  uint16
-	NumFaces   uint16
+	Plane     uint32
+	Children  [2]int32
+	Mins      [3]int16
+	Maxs      [3]int16
+	FirstFace uint16
+	NumFaces  uint16
 }
 
 type q2Plane q1Plane
@@ -85,12 +96,39 @@ func q2BSPRead(r io.Reader, flags int, m *Model) (err error) {
 		return
 	}
 
+	// planes
+	m.Planes, err = q2ReadPlanes(lumps[q2LumpPlanes].Data(q2HeaderLen, b))
+	if err != nil {
+		return
+	}
+
 	// faces
-	m.Faces, err = q2ReadFaces(b, lumps, m)
+	m.Faces, err = q2ReadFaces(b, lumps, flags, m)
+	if err != nil {
+		return
+	}
+
+	// BSP tree
+	m.Nodes, err = q2ReadNodes(lumps[q2LumpNodes].Data(q2HeaderLen, b), m)
+	if err != nil {
+		return
+	}
+
+	m.Leaves, err = q2ReadLeaves(b, lumps, m)
 	if err != nil {
 		return
 	}
 
+	if err = m.checkTree(); err != nil {
+		return
+	}
+
+	// visibility
+	m.visClusters = true
+	if flags&NoVisibility == 0 {
+		m.PVS, m.PHS, err = q2ReadVisibility(lumps[q2LumpVisibility].Data(q2HeaderLen, b))
+	}
+
 	return
 }
 
@@ -99,6 +137,94 @@ func q2ReadPlanes(b []byte) (planes []Plane, err error) {
 	return q1ReadPlanes(b)
 }
 
+func q2ReadNodes(b []byte, m *Model) (nodes []Node, err error) {
+	h := sliceHeader(&b)
+	h.Len = len(b) / 28
+	h.Cap = h.Len
+	nodes32 := *(*[]q2Node)(unsafe.Pointer(&h))
+	nodes = make([]Node, 0, len(nodes32))
+
+	for _, n := range nodes32 {
+		if int(n.Plane) >= len(m.Planes) || int(n.FirstFace)+int(n.NumFaces) > len(m.Faces) {
+			err = ErrFormat
+			return
+		}
+
+		nodes = append(nodes, Node{
+			Plane:     &m.Planes[n.Plane],
+			Children:  [2]int{int(n.Children[0]), int(n.Children[1])},
+			Mins:      sVector3(n.Mins),
+			Maxs:      sVector3(n.Maxs),
+			FirstFace: int(n.FirstFace),
+			NumFaces:  int(n.NumFaces),
+		})
+	}
+
+	return
+}
+
+func q2ReadLeaves(b []byte, lumps []bspLump, m *Model) (leaves []Leaf, err error) {
+	lb := lumps[q2LumpLeaves].Data(q2HeaderLen, b)
+	h := sliceHeader(&lb)
+	h.Len = len(lb) / 28
+	h.Cap = h.Len
+	leaves16 := *(*[]q2Leaf)(unsafe.Pointer(&h))
+	leaves = make([]Leaf, 0, len(leaves16))
+
+	// leaf tables are the same as mark surfaces in Quake
+	leafFaces := q1ReadShorts(lumps[q2LumpLeafFaceTable].Data(q2HeaderLen, b))
+	leafBrushes := q1ReadShorts(lumps[q2LumpLeafBrushTable].Data(q2HeaderLen, b))
+	numBrushes := int(lumps[q2LumpBrushes].Size / 12)
+
+	for _, l := range leaves16 {
+		var faces, brushes []int
+		if faces, err = leafList(leafFaces, int(l.FirstLeafFace), int(l.NumLeafFaces), len(m.Faces), nil); err != nil {
+			return
+		} else if brushes, err = leafList(leafBrushes, int(l.FirstLeafBrush), int(l.NumLeafBrushes), numBrushes, nil); err != nil {
+			return
+		}
+
+		leaves = append(leaves, Leaf{
+			Contents:  int(l.Contents),
+			Cluster:   int(l.Cluster),
+			VisOffset: -1,
+			Area:      int(l.Area),
+			Mins:      sVector3(l.Mins),
+			Maxs:      sVector3(l.Maxs),
+			Faces:     faces,
+			Brushes:   brushes,
+		})
+	}
+
+	return
+}
+
+// q2ReadVisibility decompresses PVS and PHS rows of clusters.
+func q2ReadVisibility(b []byte) (pvs, phs [][]byte, err error) {
+	if len(b) < 4 {
+		return
+	}
+
+	numClusters := int(Uint32(b))
+	if numClusters < 0 || 4+numClusters*8 > len(b) {
+		err = ErrFormat
+		return
+	}
+
+	rowLen := (numClusters + 7) / 8
+	pvs = make([][]byte, numClusters)
+	phs = make([][]byte, numClusters)
+	for i := 0; i < numClusters; i++ {
+		if pvs[i], err = visDecompress(b, int(Uint32(b[4+i*8:])), rowLen); err != nil {
+			return
+		} else if phs[i], err = visDecompress(b, int(Uint32(b[8+i*8:])), rowLen); err != nil {
+			return
+		}
+	}
+
+	return
+}
+
 func q2ReadTexInfo(b []byte) (texInfos []q2TexInfo, err error) {
 	h := sliceHeader(&b)
 	h.Len = len(b) / 76
@@ -107,12 +233,11 @@ func q2ReadTexInfo(b []byte) (texInfos []q2TexInfo, err error) {
 	return
 }
 
-func q2ReadFaces(b []byte, lumps []bspLump, m *Model) (out []Face, err error) {
+func q2ReadFaces(b []byte, lumps []bspLump, flags int, m *Model) (out []Face, err error) {
 	var (
 		edgeIndices []q1EdgeIndex
 		faceEdges   []int32
 		faces       []q2Face
-		planes      []Plane
 		texInfos    []q2TexInfo
 		verts       []Vector3
 	)
@@ -124,9 +249,7 @@ func q2ReadFaces(b []byte, lumps []bspLump, m *Model) (out []Face, err error) {
 	}
 
 	// many are the same as in Quake
-	if planes, err = q1ReadPlanes(data[q2LumpPlanes]); err != nil {
-		return
-	} else if verts, err = q1ReadVertices(data[q2LumpVertices]); err != nil {
+	if verts, err = q1ReadVertices(data[q2LumpVertices]); err != nil {
 		return
 	} else if texInfos, err = q2ReadTexInfo(data[q2LumpTextureInformation]); err != nil {
 		return
@@ -136,22 +259,28 @@ func q2ReadFaces(b []byte, lumps []bspLump, m *Model) (out []Face, err error) {
 		return
 	}
 
-	textures := make(map[[32]byte]*Texture)
+	texIndices := make(map[[32]byte]int)
 	m.Textures = make([]Texture, 0)
 	for _, ti := range texInfos {
-		if _, ok := textures[ti.Texture]; !ok {
+		if _, ok := texIndices[ti.Texture]; !ok {
 			nameLen := bytes.IndexByte(ti.Texture[:], 0)
 			if nameLen < 0 || nameLen > 32 {
 				nameLen = 32
 			}
+			texIndices[ti.Texture] = len(m.Textures)
 			m.Textures = append(m.Textures, Texture{
 				DataSource: dataSourceExternal{},
 				Name:       string(ti.Texture[:nameLen]),
 			})
-			textures[ti.Texture] = &m.Textures[len(m.Textures)-1]
 		}
 	}
 
+	// pointers are taken once m.Textures stops growing
+	textures := make(map[[32]byte]*Texture)
+	for name, i := range texIndices {
+		textures[name] = &m.Textures[i]
+	}
+
 	// set Next field
 	for _, ti := range texInfos {
 		if ti.Next < uint32(len(texInfos)) {
@@ -167,45 +296,63 @@ func q2ReadFaces(b []byte, lumps []bspLump, m *Model) (out []Face, err error) {
 
 	out = make([]Face, 0, len(faces))
 	for _, face := range faces {
-		v := make([]Vert, 0, int(face.NumEdges)*2)
+		v := make([]Vert, 0, int(face.NumEdges))
 		fe := faceEdges[face.FirstEdge : int(face.FirstEdge)+int(face.NumEdges)]
 
+		// edges go around the face, the first vertex of each one makes
+		// the winding
 		for _, fei := range fe {
 			if fei < 0 {
 				v = append(v, Vert{
 					Pos: verts[edgeIndices[-fei].B],
 				})
-				v = append(v, Vert{
-					Pos: verts[edgeIndices[-fei].A],
-				})
 			} else {
 				v = append(v, Vert{
 					Pos: verts[edgeIndices[fei].A],
 				})
-				v = append(v, Vert{
-					Pos: verts[edgeIndices[fei].B],
-				})
 			}
 		}
 
 		ti := &texInfos[face.TexInfoID]
-		var flags TexFlags
+		var texFlags TexFlags
 
 		s := qVector3(ti.S)
 		t := qVector3(ti.T)
 
+		lightOffset := -1
+		if face.LightMap != 0xffffffff {
+			lightOffset = int(face.LightMap)
+		}
+
 		out = append(out, Face{
-			Plane: &planes[face.Plane],
+			Front: face.Side == 0,
+			Plane: &m.Planes[face.Plane],
 			Verts: v,
 			TexInfo: TexInfo{
 				S:       s,
 				T:       t,
 				Ds:      float64(ti.Ds),
-				Dt:      float64(ti.Ds),
+				Dt:      float64(ti.Dt),
 				Texture: textures[ti.Texture],
-				Flags:   flags,
+				Flags:   texFlags,
 			},
+			Effect:       -1,
+			LightOffset:  lightOffset,
+			LightmapPage: -1,
 		})
+
+		f := &out[len(out)-1]
+		f.Normal = f.Plane.N
+		if !f.Front {
+			f.Normal = Vector3{-f.Normal[0], -f.Normal[1], -f.Normal[2]}
+		}
+		setTexCoords(f)
+
+		if lightOffset >= 0 && flags&NoLightmaps == 0 {
+			if f.Lightmap = newLightmap(v, &f.TexInfo, face.Styles); f.Lightmap != nil {
+				f.Lightmap.readRGB(data[q2LumpLightmaps], lightOffset)
+			}
+		}
 	}
 
 	return
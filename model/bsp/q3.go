@@ -2,6 +2,8 @@ package bsp
 
 import (
 	"bytes"
+	"image"
+	"image/color"
 	"io"
 	"io/ioutil"
 	"unsafe"
@@ -34,6 +36,24 @@ type q3Face struct {
 	PatchH         uint32
 }
 
+type q3Leaf struct {
+	Cluster        int32
+	Area           int32
+	Mins           [3]int32
+	Maxs           [3]int32
+	FirstLeafFace  int32
+	NumLeafFaces   int32
+	FirstLeafBrush int32
+	NumLeafBrushes int32
+}
+
+type q3Node struct {
+	Plane    int32
+	Children [2]int32
+	Mins     [3]int32
+	Maxs     [3]int32
+}
+
 type q3Plane struct {
 	N [3]float32
 	D float32
@@ -41,8 +61,8 @@ type q3Plane struct {
 
 type q3TexInfo struct {
 	Name     [64]byte
-	SurFlags q3SurfFlags
-	Contents q3Contents
+	SurFlags Q3SurfFlags
+	Contents Q3Contents
 }
 
 type q3Vertex struct {
@@ -53,63 +73,67 @@ type q3Vertex struct {
 	Color          [4]uint8
 }
 
-type q3Contents uint32
+// Q3Contents are contents of Quake3 brushes and surfaces.
+type Q3Contents uint32
 
 const (
-	q3ContentsSolid = q3Contents(1 << iota)
+	Q3ContentsSolid = Q3Contents(1 << iota)
+	_
 	_
+	Q3ContentsLava
+	Q3ContentsSlime
+	Q3ContentsWater
+	Q3ContentsFog
+	Q3ContentsNotTeam1
+	Q3ContentsNotTeam2
+	Q3ContentsNoBotClip
 	_
-	q3ContentsLava
-	q3ContentsSlime
-	q3ContentsWater
-	q3ContentsFog
-	q3ContentsNotTeam1
-	q3ContentsNotTeam2
-	q3ContentsNoBotClip
 	_
 	_
 	_
-	q3ContentsAreaPortal
-	q3ContentsPlayerClip
-	q3ContentsMonsterClip
-	q3ContentsTeleporter
-	q3ContentsJumpPad
-	q3ContentsClusterPortal
-	q3ContentsDoNotEnter
-	q3ContentsBotclip
-	q3ContentsMover
-	q3ContentsOrigin
-	q3ContentsBody
-	q3ContentsCorpse
-	q3ContentsDetail
-	q3ContentsStructural
-	q3ContentsTranslucent
-	q3ContentsTrigger
-	q3ContentsNoDrop
+	_
+	Q3ContentsAreaPortal
+	Q3ContentsPlayerClip
+	Q3ContentsMonsterClip
+	Q3ContentsTeleporter
+	Q3ContentsJumpPad
+	Q3ContentsClusterPortal
+	Q3ContentsDoNotEnter
+	Q3ContentsBotclip
+	Q3ContentsMover
+	Q3ContentsOrigin
+	Q3ContentsBody
+	Q3ContentsCorpse
+	Q3ContentsDetail
+	Q3ContentsStructural
+	Q3ContentsTranslucent
+	Q3ContentsTrigger
+	Q3ContentsNoDrop
 )
 
-type q3SurfFlags uint32
+// Q3SurfFlags are flags of Quake3 surfaces.
+type Q3SurfFlags uint32
 
 const (
-	q3SurfNoDamage = q3SurfFlags(1 << iota)
-	q3SurfSlick
-	q3SurfSky
-	q3SurfLadder
-	q3SurfNoImpact
-	q3SurfNoMarks
-	q3SurfFlesh
-	q3SurfNoDraw
-	q3SurfHint
-	q3SurfSkip
-	q3SurfNoLightmap
-	q3SurfPointLight
-	q3SurfMetalSteps
-	q3SurfNoSteps
-	q3SurfNonSolid
-	q3SurfLightFilter
-	q3SurfAlphaShadow
-	q3SurfNoDLight
-	q3SurfDust
+	Q3SurfNoDamage = Q3SurfFlags(1 << iota)
+	Q3SurfSlick
+	Q3SurfSky
+	Q3SurfLadder
+	Q3SurfNoImpact
+	Q3SurfNoMarks
+	Q3SurfFlesh
+	Q3SurfNoDraw
+	Q3SurfHint
+	Q3SurfSkip
+	Q3SurfNoLightmap
+	Q3SurfPointLight
+	Q3SurfMetalSteps
+	Q3SurfNoSteps
+	Q3SurfNonSolid
+	Q3SurfLightFilter
+	Q3SurfAlphaShadow
+	Q3SurfNoDLight
+	Q3SurfDust
 )
 
 type q3FaceType uint32
@@ -145,6 +169,9 @@ const (
 
 const q3HeaderLen = 8
 
+// Q3LightmapSize is the size of Quake3 lightmap pages.
+const Q3LightmapSize = 128
+
 func q3BSPRead(r io.Reader, flags int, m *Model) (err error) {
 	var b []byte
 
@@ -165,13 +192,44 @@ func q3BSPRead(r io.Reader, flags int, m *Model) (err error) {
 		return
 	}
 
+	// lightmaps
+	if flags&NoLightmaps == 0 {
+		m.LightmapPages = q3ReadLightmaps(lumps[q3LumpLightmaps].Data(q3HeaderLen, b), m.opts.Q3OverbrightBits)
+	}
+
+	// planes
+	m.Planes, err = q3ReadPlanes(lumps[q3LumpPlanes].Data(q3HeaderLen, b))
+	if err != nil {
+		return
+	}
+
 	// faces
-	m.Faces, err = q3ReadFaces(b, lumps, m)
+	var faceIndex []int
+	m.Faces, faceIndex, err = q3ReadFaces(b, lumps, m)
+	if err != nil {
+		return
+	}
+
+	// BSP tree
+	m.Nodes, err = q3ReadNodes(lumps[q3LumpNodes].Data(q3HeaderLen, b), m)
 	if err != nil {
 		return
 	}
 
-	m.Triangle = true
+	m.Leaves, err = q3ReadLeaves(b, lumps, faceIndex)
+	if err != nil {
+		return
+	}
+
+	if err = m.checkTree(); err != nil {
+		return
+	}
+
+	// visibility
+	m.visClusters = true
+	if flags&NoVisibility == 0 {
+		m.PVS, err = q3ReadVisibility(lumps[q3LumpVisibility].Data(q3HeaderLen, b))
+	}
 
 	return
 }
@@ -195,6 +253,101 @@ func q3ReadPlanes(b []byte) (planes []Plane, err error) {
 	return
 }
 
+func q3ReadNodes(b []byte, m *Model) (nodes []Node, err error) {
+	h := sliceHeader(&b)
+	h.Len = len(b) / 36
+	h.Cap = h.Len
+	nodes32 := *(*[]q3Node)(unsafe.Pointer(&h))
+	nodes = make([]Node, 0, len(nodes32))
+
+	for _, n := range nodes32 {
+		if n.Plane < 0 || int(n.Plane) >= len(m.Planes) {
+			err = ErrFormat
+			return
+		}
+
+		nodes = append(nodes, Node{
+			Plane:    &m.Planes[n.Plane],
+			Children: [2]int{int(n.Children[0]), int(n.Children[1])},
+			Mins:     iVector3(n.Mins),
+			Maxs:     iVector3(n.Maxs),
+		})
+	}
+
+	return
+}
+
+// q3ReadLeaves reads leaves, with faceIndex mapping face lump entries to
+// indices into Model.Faces.
+func q3ReadLeaves(b []byte, lumps []bspLump, faceIndex []int) (leaves []Leaf, err error) {
+	lb := lumps[q3LumpLeaves].Data(q3HeaderLen, b)
+	h := sliceHeader(&lb)
+	h.Len = len(lb) / 48
+	h.Cap = h.Len
+	leaves32 := *(*[]q3Leaf)(unsafe.Pointer(&h))
+	leaves = make([]Leaf, 0, len(leaves32))
+
+	leafFaces := q3ReadInts(lumps[q3LumpLeafFaceTable].Data(q3HeaderLen, b))
+	leafBrushes := q3ReadInts(lumps[q3LumpLeafBrushTable].Data(q3HeaderLen, b))
+	numBrushes := int(lumps[q3LumpBrushes].Size / 12)
+
+	for _, l := range leaves32 {
+		var faces, brushes []int
+		if faces, err = leafList(leafFaces, int(l.FirstLeafFace), int(l.NumLeafFaces), len(faceIndex), faceIndex); err != nil {
+			return
+		} else if brushes, err = leafList(leafBrushes, int(l.FirstLeafBrush), int(l.NumLeafBrushes), numBrushes, nil); err != nil {
+			return
+		}
+
+		leaves = append(leaves, Leaf{
+			Cluster:   int(l.Cluster),
+			VisOffset: -1,
+			Area:      int(l.Area),
+			Mins:      iVector3(l.Mins),
+			Maxs:      iVector3(l.Maxs),
+			Faces:     faces,
+			Brushes:   brushes,
+		})
+	}
+
+	return
+}
+
+// q3ReadInts reads a table of ints, such as leaf faces.
+func q3ReadInts(b []byte) (table []int) {
+	h := sliceHeader(&b)
+	h.Len = len(b) / 4
+	h.Cap = h.Len
+	ints := *(*[]int32)(unsafe.Pointer(&h))
+	table = make([]int, 0, len(ints))
+
+	for _, i := range ints {
+		table = append(table, int(i))
+	}
+
+	return
+}
+
+// q3ReadVisibility reads PVS rows of clusters, which are not compressed.
+func q3ReadVisibility(b []byte) (rows [][]byte, err error) {
+	if len(b) < 8 {
+		return
+	}
+
+	numVecs, sizeVecs := int(int32(Uint32(b))), int(int32(Uint32(b[4:])))
+	if numVecs < 0 || sizeVecs < 0 || 8+numVecs*sizeVecs > len(b) {
+		err = ErrFormat
+		return
+	}
+
+	rows = make([][]byte, 0, numVecs)
+	for i := 0; i < numVecs; i++ {
+		rows = append(rows, b[8+i*sizeVecs:8+(i+1)*sizeVecs])
+	}
+
+	return
+}
+
 func q3ReadTexInfo(b []byte) (texInfos []q3TexInfo, err error) {
 	h := sliceHeader(&b)
 	h.Len = len(b) / 72
@@ -211,27 +364,117 @@ func q3ReadMeshVertices(b []byte) (meshVerts []uint32, err error) {
 	return
 }
 
-func q3ReadVertices(b []byte) (vertices []Vector3, err error) {
+func q3ReadVertices(b []byte, shift uint) (vertices []Vert, err error) {
 	h := sliceHeader(&b)
 	h.Len = len(b) / 44
 	h.Cap = h.Len
 	verts32 := *(*[]q3Vertex)(unsafe.Pointer(&h))
-	vertices = make([]Vector3, 0, len(verts32)) // FIXME -- general case
+	vertices = make([]Vert, 0, len(verts32))
 
 	for i := 0; i < cap(vertices); i++ {
-		vertices = append(vertices, qVector3(verts32[i].Position))
+		v := &verts32[i]
+		r, g, b := q3ShiftColor(v.Color[0], v.Color[1], v.Color[2], shift)
+		vertices = append(vertices, Vert{
+			Pos:           qVector3(v.Position),
+			Normal:        qVector3(v.Normal),
+			TexCoord:      [2]float64{float64(v.SurfCoords[0]), float64(v.SurfCoords[1])},
+			LightmapCoord: [2]float64{float64(v.LightMapCoords[0]), float64(v.LightMapCoords[1])},
+			Color:         color.NRGBA{r, g, b, v.Color[3]},
+		})
 	}
 
 	return
 }
 
-func q3ReadFaces(b []byte, lumps []bspLump, m *Model) (out []Face, err error) {
+func q3ReadLightmaps(b []byte, shift uint) (pages []*image.RGBA) {
+	const size = Q3LightmapSize * Q3LightmapSize * 3
+
+	pages = make([]*image.RGBA, 0, len(b)/size)
+	for i := 0; i+size <= len(b); i += size {
+		im := image.NewRGBA(image.Rect(0, 0, Q3LightmapSize, Q3LightmapSize))
+		src := b[i : i+size]
+		for j := 0; j < Q3LightmapSize*Q3LightmapSize; j++ {
+			im.Pix[j*4+0], im.Pix[j*4+1], im.Pix[j*4+2] = q3ShiftColor(src[j*3+0], src[j*3+1], src[j*3+2], shift)
+			im.Pix[j*4+3] = 0xff
+		}
+		pages = append(pages, im)
+	}
+
+	return
+}
+
+// q3ShiftColor shifts a colour by Options.Q3OverbrightBits.
+func q3ShiftColor(r, g, b uint8, shift uint) (uint8, uint8, uint8) {
+	if shift == 0 {
+		return r, g, b
+	}
+
+	c := [3]int{int(r) << shift, int(g) << shift, int(b) << shift}
+	max := c[0]
+	if c[1] > max {
+		max = c[1]
+	}
+	if c[2] > max {
+		max = c[2]
+	}
+
+	if max > 255 {
+		for i := range c {
+			c[i] = c[i] * 255 / max
+		}
+	}
+
+	return uint8(c[0]), uint8(c[1]), uint8(c[2])
+}
+
+func q3ReadTextures(texInfos []q3TexInfo) (texs []Texture) {
+	texs = make([]Texture, 0, len(texInfos))
+	for _, ti := range texInfos {
+		nameLen := bytes.IndexByte(ti.Name[:], 0)
+		if nameLen < 0 {
+			nameLen = len(ti.Name)
+		}
+
+		texs = append(texs, Texture{
+			DataSource: dataSourceExternal{},
+			Name:       string(ti.Name[:nameLen]),
+		})
+	}
+
+	return
+}
+
+func q3ReadEffects(b []byte) (effects []Effect) {
+	h := sliceHeader(&b)
+	h.Len = len(b) / 72
+	h.Cap = h.Len
+	effects32 := *(*[]q3Effect)(unsafe.Pointer(&h))
+	effects = make([]Effect, 0, len(effects32))
+
+	for _, e := range effects32 {
+		nameLen := bytes.IndexByte(e.Name[:], 0)
+		if nameLen < 0 {
+			nameLen = len(e.Name)
+		}
+
+		effects = append(effects, Effect{
+			Shader: string(e.Name[:nameLen]),
+			Brush:  int(int32(e.Brush)),
+			Side:   int(int32(e.Side)),
+		})
+	}
+
+	return
+}
+
+// q3ReadFaces reads faces, except for billboards which become flares.
+// faceIndex maps face lump entries to indices into out, -1 for billboards.
+func q3ReadFaces(b []byte, lumps []bspLump, m *Model) (out []Face, faceIndex []int, err error) {
 	var (
 		faces     []q3Face
-		planes    []Plane
 		texInfos  []q3TexInfo
 		meshVerts []uint32
-		verts     []Vector3
+		verts     []Vert
 	)
 
 	data := make([][]byte, len(lumps))
@@ -240,10 +483,7 @@ func q3ReadFaces(b []byte, lumps []bspLump, m *Model) (out []Face, err error) {
 		data[i] = d
 	}
 
-	// many are the same as in Quake
-	if planes, err = q3ReadPlanes(data[q3LumpPlanes]); err != nil {
-		return
-	} else if verts, err = q3ReadVertices(data[q3LumpVertices]); err != nil {
+	if verts, err = q3ReadVertices(data[q3LumpVertices], m.opts.Q3OverbrightBits); err != nil {
 		return
 	} else if texInfos, err = q3ReadTexInfo(data[q3LumpTextureInformation]); err != nil {
 		return
@@ -251,37 +491,131 @@ func q3ReadFaces(b []byte, lumps []bspLump, m *Model) (out []Face, err error) {
 		return
 	}
 
+	m.Textures = q3ReadTextures(texInfos)
+	m.Effects = q3ReadEffects(data[q3LumpEffects])
+
 	fb := lumps[q3LumpFaces].Data(q3HeaderLen, b)
 	h := sliceHeader(&fb)
 	h.Len = int(lumps[q3LumpFaces].Size / 104)
 	h.Cap = h.Len
 	faces = *(*[]q3Face)(unsafe.Pointer(&h))
 
-	// FIXME -- only polygons for now
 	out = make([]Face, 0)
+	faceIndex = make([]int, 0, len(faces))
 	for _, face := range faces {
-		var v []Vert
-
-		if face.Type == q3FacePolygon || face.Type == q3FaceMesh {
-			v = make([]Vert, 0)
-			for i := uint32(0); i < face.NumMeshVerts; i++ {
-				v = append(v, Vert{
-					Pos: verts[face.FirstVertex+meshVerts[face.FirstMeshVert+i]],
-				})
+		if face.Type == q3FaceBillboard {
+			m.Flares = append(m.Flares, q3Flare(&face, m))
+			faceIndex = append(faceIndex, -1)
+			continue
+		}
+
+		var (
+			v       []Vert
+			indices []int
+		)
+
+		switch face.Type {
+		case q3FacePolygon, q3FaceMesh:
+			if uint64(face.FirstVertex)+uint64(face.NumVerts) > uint64(len(verts)) ||
+				uint64(face.FirstMeshVert)+uint64(face.NumMeshVerts) > uint64(len(meshVerts)) {
+				err = ErrFormat
+				return
 			}
-		} else {
+
+			v = make([]Vert, face.NumVerts)
+			copy(v, verts[face.FirstVertex:face.FirstVertex+face.NumVerts])
+
+			indices = make([]int, face.NumMeshVerts)
+			for i := range indices {
+				mv := meshVerts[face.FirstMeshVert+uint32(i)]
+				if uint64(mv) >= uint64(len(v)) {
+					err = ErrFormat
+					return
+				}
+				indices[i] = int(mv)
+			}
+		case q3FacePatch:
+			if uint64(face.FirstVertex)+uint64(face.NumVerts) > uint64(len(verts)) {
+				err = ErrFormat
+				return
+			}
+
+			ctrl := verts[face.FirstVertex : face.FirstVertex+face.NumVerts]
+			if v, indices, err = q3Tessellate(ctrl, int(face.PatchW), int(face.PatchH), m.opts.Q3PatchLevel); err != nil {
+				return
+			}
+		default:
+			faceIndex = append(faceIndex, -1)
 			continue
 		}
+
+		lightmapPage := -1
+		if int32(face.LightMap) >= 0 && int(face.LightMap) < len(m.LightmapPages) {
+			lightmapPage = int(face.LightMap)
+		}
+
+		effect := -1
+		if int32(face.Effect) >= 0 && int(face.Effect) < len(m.Effects) {
+			effect = int(face.Effect)
+		}
+
+		var texInfo TexInfo
+		if int(face.Texture) < len(texInfos) {
+			ti := &texInfos[face.Texture]
+			texInfo = TexInfo{
+				Texture:      &m.Textures[face.Texture],
+				SurfaceFlags: ti.SurFlags,
+				Contents:     ti.Contents,
+			}
+		}
+
+		normal := qVector3(face.Normal)
+
+		// meshes and patches are not planar
+		var plane *Plane
+		if face.Type == q3FacePolygon && len(v) > 0 {
+			p := v[0].Pos
+			plane = &Plane{
+				N: normal,
+				D: normal[0]*p[0] + normal[1]*p[1] + normal[2]*p[2],
+				T: PlaneNoType,
+			}
+		}
+
+		faceIndex = append(faceIndex, len(out))
 		out = append(out, Face{
-			Verts:   v,
-			Plane:   nil,
-			TexInfo: TexInfo{},
+			Verts:        v,
+			Indices:      indices,
+			Front:        true,
+			Plane:        plane,
+			Normal:       normal,
+			TexInfo:      texInfo,
+			Effect:       effect,
+			LightOffset:  -1,
+			LightmapPage: lightmapPage,
 		})
 	}
 
-	_ = planes
-	_ = texInfos
-	_ = meshVerts
+	return
+}
+
+// q3Flare makes a flare from a billboard face, which keeps its origin in
+// the lightmap origin and its colour in the lightmap S vector.
+func q3Flare(face *q3Face, m *Model) (fl Flare) {
+	fl = Flare{
+		Origin: qVector3(face.LightMapOrigin),
+		Normal: qVector3(face.Normal),
+		Color:  qVector3(face.LightMapS),
+		Effect: -1,
+	}
+
+	if int(face.Texture) < len(m.Textures) {
+		fl.Shader = m.Textures[face.Texture].Name
+	}
+
+	if int32(face.Effect) >= 0 && int(face.Effect) < len(m.Effects) {
+		fl.Effect = int(face.Effect)
+	}
 
 	return
 }
@@ -0,0 +1,31 @@
+package bsp
+
+// setTexCoords sets texture coordinates of face vertices from the texture
+// projection, if the texture size is known.
+func setTexCoords(f *Face) {
+	tex := f.TexInfo.Texture
+	if tex == nil || tex.Width <= 0 || tex.Height <= 0 {
+		return
+	}
+
+	for i := range f.Verts {
+		st := texCoords(f.Verts[i].Pos, &f.TexInfo)
+		f.Verts[i].TexCoord = [2]float64{
+			st[0] / float64(tex.Width),
+			st[1] / float64(tex.Height),
+		}
+	}
+}
+
+// SetTextureSize sets the size of a texture and computes texture
+// coordinates of faces using it. It is meant for textures of Quake2 maps,
+// which size is only known once the .wal file is loaded.
+func (m *Model) SetTextureSize(t *Texture, width, height int) {
+	t.Width, t.Height = width, height
+
+	for i := range m.Faces {
+		if f := &m.Faces[i]; f.TexInfo.Texture == t {
+			setTexCoords(f)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package bsp
+
+// leafList returns num entries of a leaf face or brush table starting at
+// first, each one checked to be below limit. Entries are mapped through
+// index if it is not nil, dropping the ones mapped to -1.
+func leafList(table []int, first, num, limit int, index []int) (list []int, err error) {
+	if first < 0 || num < 0 || first+num > len(table) {
+		err = ErrFormat
+		return
+	}
+
+	list = make([]int, 0, num)
+	for _, i := range table[first : first+num] {
+		if i < 0 || i >= limit {
+			err = ErrFormat
+			return
+		}
+
+		if index != nil {
+			if i = index[i]; i < 0 {
+				continue
+			}
+		}
+
+		list = append(list, i)
+	}
+
+	return
+}
+
+// checkTree makes sure children of all nodes are in range.
+func (m *Model) checkTree() error {
+	for i := range m.Nodes {
+		for _, c := range m.Nodes[i].Children {
+			if c >= len(m.Nodes) || -(c+1) >= len(m.Leaves) {
+				return ErrFormat
+			}
+		}
+	}
+
+	return nil
+}
+
+// PointLeaf returns the index of the leaf of the world containing a point,
+// -1 if the map has no nodes or the tree loops.
+func (m *Model) PointLeaf(p Vector3) int {
+	if len(m.Nodes) == 0 {
+		return -1
+	}
+
+	i := 0
+	for depth := 0; i >= 0; depth++ {
+		if depth >= len(m.Nodes) {
+			return -1
+		}
+
+		n := &m.Nodes[i]
+		if n.Plane.N[0]*p[0]+n.Plane.N[1]*p[1]+n.Plane.N[2]*p[2]-n.Plane.D >= 0 {
+			i = n.Children[0]
+		} else {
+			i = n.Children[1]
+		}
+	}
+
+	return -(i + 1)
+}
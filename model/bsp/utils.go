@@ -100,6 +100,14 @@ func qVector3(v [3]float32) Vector3 {
 	return Vector3{float64(v[0]), float64(v[1]), float64(v[2])}
 }
 
+func sVector3(v [3]int16) Vector3 {
+	return Vector3{float64(v[0]), float64(v[1]), float64(v[2])}
+}
+
+func iVector3(v [3]int32) Vector3 {
+	return Vector3{float64(v[0]), float64(v[1]), float64(v[2])}
+}
+
 func sliceHeader(raw *[]byte) reflect.SliceHeader {
 	return *(*reflect.SliceHeader)(unsafe.Pointer(raw))
 }
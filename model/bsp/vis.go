@@ -0,0 +1,119 @@
+package bsp
+
+// visDecompress decompresses a run-length encoded row of rowLen bytes at
+// offset, zero bytes being followed by the number of zeros.
+func visDecompress(b []byte, offset, rowLen int) (row []byte, err error) {
+	if offset < 0 || offset > len(b) {
+		err = ErrFormat
+		return
+	}
+
+	row = make([]byte, 0, rowLen)
+	for i := offset; len(row) < rowLen; i++ {
+		if i >= len(b) {
+			err = ErrFormat
+			return
+		}
+
+		if c := b[i]; c != 0 {
+			row = append(row, c)
+			continue
+		}
+
+		if i++; i >= len(b) {
+			err = ErrFormat
+			return
+		}
+
+		n := min(int(b[i]), rowLen-len(row))
+		row = append(row, make([]byte, n)...)
+	}
+
+	return
+}
+
+// visRow returns the row of rows for a leaf and the bit standing for it in
+// other rows. A nil row with all set sees everything.
+func (m *Model) visRow(rows [][]byte, leaf int) (row []byte, bit int, all bool) {
+	if m.visClusters {
+		if bit = m.Leaves[leaf].Cluster; bit >= 0 && bit < len(rows) {
+			row = rows[bit]
+		}
+		return
+	}
+
+	// leaf 0 is the solid leaf outside of Quake maps
+	bit = leaf - 1
+	if leaf > 0 {
+		row = rows[leaf]
+		all = row == nil
+	}
+
+	return
+}
+
+func (m *Model) visible(rows [][]byte, a, b int) bool {
+	if a < 0 || a >= len(m.Leaves) || b < 0 || b >= len(m.Leaves) {
+		return false
+	} else if rows == nil {
+		return true
+	}
+
+	row, _, all := m.visRow(rows, a)
+	_, bit, _ := m.visRow(rows, b)
+	if bit < 0 {
+		return false
+	} else if all {
+		return true
+	}
+
+	return bit>>3 < len(row) && row[bit>>3]&(1<<(bit&7)) != 0
+}
+
+// CanSee reports whether leaf b is in the potentially visible set of leaf a.
+// Every leaf is visible if the map has no visibility information or it was
+// read with NoVisibility.
+func (m *Model) CanSee(a, b int) bool {
+	return m.visible(m.PVS, a, b)
+}
+
+// CanHear reports whether leaf b is in the potentially hearable set of leaf
+// a. Every leaf is hearable in maps other than Quake2 ones.
+func (m *Model) CanHear(a, b int) bool {
+	return m.visible(m.PHS, a, b)
+}
+
+// VisibleLeaves returns indices of leaves visible from a leaf.
+func (m *Model) VisibleLeaves(leaf int) (leaves []int) {
+	for i := range m.Leaves {
+		if m.CanSee(leaf, i) {
+			leaves = append(leaves, i)
+		}
+	}
+
+	return
+}
+
+// VisibleFaces returns indices of faces in leaves visible from a point, in
+// increasing order.
+func (m *Model) VisibleFaces(p Vector3) (faces []int) {
+	leaf := m.PointLeaf(p)
+	if leaf < 0 {
+		return
+	}
+
+	seen := make([]bool, len(m.Faces))
+	for _, l := range m.VisibleLeaves(leaf) {
+		for _, f := range m.Leaves[l].Faces {
+			seen[f] = true
+		}
+	}
+
+	for f, ok := range seen {
+		if ok {
+			faces = append(faces, f)
+		}
+	}
+
+	return
+}
@@ -0,0 +1,123 @@
+package gltf
+
+import (
+	"github.com/ftrvxmtrx/groke/model/md2"
+	"github.com/ftrvxmtrx/groke/model/mdl"
+	"github.com/ftrvxmtrx/groke/model/vertexanim"
+	"image"
+)
+
+// FrameTime is the duration of a frame not part of a frame group, both
+// Quake and Quake2 animate models at 10 frames per second.
+const FrameTime = 0.1
+
+// remap splits frame vertices so each has a single texture coordinate.
+type remap struct {
+	keys  map[[2]int]int
+	verts []int // frame vertex of each output vertex
+	uvs   [][2]float64
+}
+
+func (r *remap) vertex(vert, key int, uv [2]float64) int {
+	k := [2]int{vert, key}
+	if i, ok := r.keys[k]; ok {
+		return i
+	}
+
+	r.keys[k] = len(r.verts)
+	r.verts = append(r.verts, vert)
+	r.uvs = append(r.uvs, uv)
+
+	return len(r.verts) - 1
+}
+
+func (r *remap) frames(in []vertexanim.Frame) (out []vertexanim.Frame) {
+	out = make([]vertexanim.Frame, len(in))
+	for i, f := range in {
+		out[i] = vertexanim.Frame{
+			Name:    f.Name,
+			Pos:     make([]vertexanim.Vector3, len(r.verts)),
+			Normals: make([]vertexanim.Vector3, len(r.verts)),
+		}
+
+		for j, v := range r.verts {
+			out[i].Pos[j] = f.Pos[v]
+			out[i].Normals[j] = f.Normals[v]
+		}
+	}
+
+	return
+}
+
+// FromMDL converts a Quake alias model, using its first skin.
+func FromMDL(name string, m *mdl.Model) *Model {
+	r := &remap{keys: make(map[[2]int]int)}
+	w, h := float64(m.SkinWidth), float64(m.SkinHeight)
+	out := &Model{Name: name}
+
+	for _, t := range m.Triangles {
+		var tri [3]int
+		for i, v := range t.Verts {
+			tc := m.TexCoords[v]
+			s, seam := float64(tc.S), 0
+			if tc.OnSeam && !t.FacesFront {
+				s += w / 2
+				seam = 1
+			}
+
+			tri[i] = r.vertex(v, seam, [2]float64{(s + 0.5) / w, (float64(tc.T) + 0.5) / h})
+		}
+
+		// front faces are clockwise in Quake
+		out.Triangles = append(out.Triangles, [3]int{tri[0], tri[2], tri[1]})
+	}
+
+	out.TexCoords = r.uvs
+	out.Frames = r.frames(m.AnimFrames())
+
+	for _, g := range m.Frames {
+		if g.Times == nil {
+			out.Durations = append(out.Durations, FrameTime)
+			continue
+		}
+
+		var prev float64
+		for _, t := range g.Times {
+			out.Durations = append(out.Durations, t-prev)
+			prev = t
+		}
+	}
+
+	if len(m.Skins) > 0 && len(m.Skins[0].Images) > 0 {
+		out.Skin = m.Skins[0].Images[0]
+	}
+
+	return out
+}
+
+// FromMD2 converts a Quake2 model with the given skin, which may be nil.
+func FromMD2(name string, m *md2.Model, skin image.Image) *Model {
+	r := &remap{keys: make(map[[2]int]int)}
+	w, h := float64(m.SkinWidth), float64(m.SkinHeight)
+	out := &Model{Name: name, Skin: skin}
+
+	for _, t := range m.Triangles {
+		var tri [3]int
+		for i, v := range t.Verts {
+			tc := m.TexCoords[t.TexCoords[i]]
+			tri[i] = r.vertex(v, t.TexCoords[i], [2]float64{float64(tc.S) / w, float64(tc.T) / h})
+		}
+
+		// front faces are clockwise in Quake2
+		out.Triangles = append(out.Triangles, [3]int{tri[0], tri[2], tri[1]})
+	}
+
+	out.TexCoords = r.uvs
+	out.Frames = r.frames(m.AnimFrames())
+	out.Durations = make([]float64, len(out.Frames))
+	for i := range out.Durations {
+		out.Durations[i] = FrameTime
+	}
+
+	return out
+}
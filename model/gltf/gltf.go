@@ -0,0 +1,385 @@
+/*
+Package gltf provides support for writing vertex-animated models as binary
+glTF 2.0 (.glb) files, with frames as morph targets.
+*/
+package gltf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"github.com/ftrvxmtrx/groke/model/vertexanim"
+	"image"
+	"image/png"
+	"io"
+	"math"
+)
+
+// Model is a mesh ready to be written. Frames share the vertex layout of
+// TexCoords, the first frame being the base mesh.
+type Model struct {
+	Name      string
+	Frames    []vertexanim.Frame
+	Durations []float64 // seconds per frame
+	Triangles [][3]int  // counter-clockwise, as glTF expects
+	TexCoords [][2]float64
+	Skin      image.Image // nil if none
+}
+
+var (
+	ErrEmpty = errors.New("gltf: model has no frames")
+)
+
+// Generator is written to the asset description.
+var Generator = "groke"
+
+const (
+	glbMagic     = 0x46546c67 // "glTF"
+	glbChunkJSON = 0x4e4f534a // "JSON"
+	glbChunkBIN  = 0x004e4942 // "BIN\0"
+
+	componentFloat  = 5126
+	componentUint32 = 5125
+
+	targetArrayBuffer        = 34962
+	targetElementArrayBuffer = 34963
+
+	filterNearest = 9728
+)
+
+type gltfAsset struct {
+	Version   string `json:"version"`
+	Generator string `json:"generator,omitempty"`
+}
+
+type gltfScene struct {
+	Nodes []int `json:"nodes"`
+}
+
+type gltfNode struct {
+	Name string `json:"name,omitempty"`
+	Mesh int    `json:"mesh"`
+}
+
+type gltfPrimitive struct {
+	Attributes map[string]int   `json:"attributes"`
+	Indices    int              `json:"indices"`
+	Material   *int             `json:"material,omitempty"`
+	Targets    []map[string]int `json:"targets,omitempty"`
+}
+
+type gltfMeshExtras struct {
+	TargetNames []string `json:"targetNames"`
+}
+
+type gltfMesh struct {
+	Name       string          `json:"name,omitempty"`
+	Primitives []gltfPrimitive `json:"primitives"`
+	Extras     *gltfMeshExtras `json:"extras,omitempty"`
+}
+
+type gltfTextureInfo struct {
+	Index int `json:"index"`
+}
+
+type gltfPBR struct {
+	BaseColorTexture *gltfTextureInfo `json:"baseColorTexture,omitempty"`
+	MetallicFactor   float64          `json:"metallicFactor"`
+}
+
+type gltfMaterial struct {
+	PBR gltfPBR `json:"pbrMetallicRoughness"`
+}
+
+type gltfTexture struct {
+	Sampler int `json:"sampler"`
+	Source  int `json:"source"`
+}
+
+type gltfSampler struct {
+	MagFilter int `json:"magFilter"`
+	MinFilter int `json:"minFilter"`
+}
+
+type gltfImage struct {
+	BufferView int    `json:"bufferView"`
+	MimeType   string `json:"mimeType"`
+}
+
+type gltfBuffer struct {
+	ByteLength int `json:"byteLength"`
+}
+
+type gltfBufferView struct {
+	Buffer     int `json:"buffer"`
+	ByteOffset int `json:"byteOffset"`
+	ByteLength int `json:"byteLength"`
+	Target     int `json:"target,omitempty"`
+}
+
+type gltfAccessor struct {
+	BufferView    int       `json:"bufferView"`
+	ComponentType int       `json:"componentType"`
+	Count         int       `json:"count"`
+	Type          string    `json:"type"`
+	Min           []float32 `json:"min,omitempty"`
+	Max           []float32 `json:"max,omitempty"`
+}
+
+type gltfChannelTarget struct {
+	Node int    `json:"node"`
+	Path string `json:"path"`
+}
+
+type gltfChannel struct {
+	Sampler int               `json:"sampler"`
+	Target  gltfChannelTarget `json:"target"`
+}
+
+type gltfAnimSampler struct {
+	Input         int    `json:"input"`
+	Output        int    `json:"output"`
+	Interpolation string `json:"interpolation"`
+}
+
+type gltfAnimation struct {
+	Name     string            `json:"name,omitempty"`
+	Channels []gltfChannel     `json:"channels"`
+	Samplers []gltfAnimSampler `json:"samplers"`
+}
+
+type gltfDocument struct {
+	Asset       gltfAsset        `json:"asset"`
+	Scene       int              `json:"scene"`
+	Scenes      []gltfScene      `json:"scenes"`
+	Nodes       []gltfNode       `json:"nodes"`
+	Meshes      []gltfMesh       `json:"meshes"`
+	Materials   []gltfMaterial   `json:"materials,omitempty"`
+	Textures    []gltfTexture    `json:"textures,omitempty"`
+	Samplers    []gltfSampler    `json:"samplers,omitempty"`
+	Images      []gltfImage      `json:"images,omitempty"`
+	Animations  []gltfAnimation  `json:"animations,omitempty"`
+	Accessors   []gltfAccessor   `json:"accessors"`
+	BufferViews []gltfBufferView `json:"bufferViews"`
+	Buffers     []gltfBuffer     `json:"buffers"`
+}
+
+// writer accumulates the binary chunk along with views and accessors.
+type writer struct {
+	doc gltfDocument
+	bin bytes.Buffer
+}
+
+func (w *writer) view(data []byte, target int) int {
+	for w.bin.Len()%4 != 0 {
+		w.bin.WriteByte(0)
+	}
+
+	w.doc.BufferViews = append(w.doc.BufferViews, gltfBufferView{
+		ByteOffset: w.bin.Len(),
+		ByteLength: len(data),
+		Target:     target,
+	})
+	w.bin.Write(data)
+
+	return len(w.doc.BufferViews) - 1
+}
+
+func (w *writer) accessor(a gltfAccessor) int {
+	w.doc.Accessors = append(w.doc.Accessors, a)
+	return len(w.doc.Accessors) - 1
+}
+
+func (w *writer) floats(values []float32, typ string, n int, target int, bounds bool) int {
+	var b bytes.Buffer
+	binary.Write(&b, binary.LittleEndian, values)
+
+	a := gltfAccessor{
+		BufferView:    w.view(b.Bytes(), target),
+		ComponentType: componentFloat,
+		Count:         len(values) / n,
+		Type:          typ,
+	}
+
+	if bounds && len(values) > 0 {
+		a.Min = append([]float32(nil), values[:n]...)
+		a.Max = append([]float32(nil), values[:n]...)
+		for i := n; i < len(values); i++ {
+			a.Min[i%n] = float32(math.Min(float64(a.Min[i%n]), float64(values[i])))
+			a.Max[i%n] = float32(math.Max(float64(a.Max[i%n]), float64(values[i])))
+		}
+	}
+
+	return w.accessor(a)
+}
+
+// vec3s converts Quake coordinates (Z up) to glTF ones (Y up), subtracting
+// base if not nil.
+func vec3s(vs, base []vertexanim.Vector3) []float32 {
+	out := make([]float32, 0, len(vs)*3)
+	for i, v := range vs {
+		if base != nil {
+			v = vertexanim.Vector3{v[0] - base[i][0], v[1] - base[i][1], v[2] - base[i][2]}
+		}
+		out = append(out, float32(v[1]), float32(v[2]), float32(v[0]))
+	}
+
+	return out
+}
+
+// Write writes a model as a binary glTF file. Named frame sequences become
+// animations of morph target weights.
+func Write(out io.Writer, m *Model) (err error) {
+	if len(m.Frames) == 0 {
+		return ErrEmpty
+	}
+
+	w := &writer{
+		doc: gltfDocument{
+			Asset:  gltfAsset{Version: "2.0", Generator: Generator},
+			Scenes: []gltfScene{{Nodes: []int{0}}},
+			Nodes:  []gltfNode{{Name: m.Name, Mesh: 0}},
+		},
+	}
+
+	base := &m.Frames[0]
+
+	// indices
+	indices := make([]uint32, 0, len(m.Triangles)*3)
+	for _, t := range m.Triangles {
+		indices = append(indices, uint32(t[0]), uint32(t[1]), uint32(t[2]))
+	}
+
+	var b bytes.Buffer
+	binary.Write(&b, binary.LittleEndian, indices)
+
+	prim := gltfPrimitive{
+		Attributes: map[string]int{
+			"POSITION": w.floats(vec3s(base.Pos, nil), "VEC3", 3, targetArrayBuffer, true),
+			"NORMAL":   w.floats(vec3s(base.Normals, nil), "VEC3", 3, targetArrayBuffer, false),
+		},
+	}
+
+	uvs := make([]float32, 0, len(m.TexCoords)*2)
+	for _, uv := range m.TexCoords {
+		uvs = append(uvs, float32(uv[0]), float32(uv[1]))
+	}
+	prim.Attributes["TEXCOORD_0"] = w.floats(uvs, "VEC2", 2, targetArrayBuffer, false)
+
+	prim.Indices = w.accessor(gltfAccessor{
+		BufferView:    w.view(b.Bytes(), targetElementArrayBuffer),
+		ComponentType: componentUint32,
+		Count:         len(indices),
+		Type:          "SCALAR",
+	})
+
+	// morph targets, one per frame
+	mesh := gltfMesh{Name: m.Name}
+	if len(m.Frames) > 1 {
+		mesh.Extras = &gltfMeshExtras{}
+		for i := range m.Frames {
+			f := &m.Frames[i]
+			prim.Targets = append(prim.Targets, map[string]int{
+				"POSITION": w.floats(vec3s(f.Pos, base.Pos), "VEC3", 3, targetArrayBuffer, true),
+				"NORMAL":   w.floats(vec3s(f.Normals, base.Normals), "VEC3", 3, targetArrayBuffer, false),
+			})
+			mesh.Extras.TargetNames = append(mesh.Extras.TargetNames, f.Name)
+		}
+	}
+
+	// skin
+	if m.Skin != nil {
+		b.Reset()
+		if err = png.Encode(&b, m.Skin); err != nil {
+			return
+		}
+
+		material := 0
+		prim.Material = &material
+		w.doc.Images = []gltfImage{{BufferView: w.view(b.Bytes(), 0), MimeType: "image/png"}}
+		w.doc.Samplers = []gltfSampler{{MagFilter: filterNearest, MinFilter: filterNearest}}
+		w.doc.Textures = []gltfTexture{{Sampler: 0, Source: 0}}
+		w.doc.Materials = []gltfMaterial{{PBR: gltfPBR{BaseColorTexture: &gltfTextureInfo{0}}}}
+	}
+
+	mesh.Primitives = []gltfPrimitive{prim}
+	w.doc.Meshes = []gltfMesh{mesh}
+
+	if len(m.Frames) > 1 {
+		w.animations(m)
+	}
+
+	return w.write(out)
+}
+
+// animations adds an animation per frame sequence. Every frame is a
+// keyframe with its target weight set to 1; a final keyframe goes back to
+// the first frame of the sequence so it loops with the original timing.
+func (w *writer) animations(m *Model) {
+	names := make([]string, len(m.Frames))
+	for i, f := range m.Frames {
+		names[i] = f.Name
+	}
+
+	for _, seq := range vertexanim.Sequences(names) {
+		frames := append(seq.Frames, seq.Frames[0])
+		times := make([]float32, len(frames))
+		weights := make([]float32, len(frames)*len(m.Frames))
+
+		var t float64
+		for i, f := range frames {
+			times[i] = float32(t)
+			weights[i*len(m.Frames)+f] = 1
+			if f < len(m.Durations) {
+				t += m.Durations[f]
+			}
+		}
+
+		w.doc.Animations = append(w.doc.Animations, gltfAnimation{
+			Name: seq.Name,
+			Channels: []gltfChannel{
+				{Sampler: 0, Target: gltfChannelTarget{Node: 0, Path: "weights"}},
+			},
+			Samplers: []gltfAnimSampler{{
+				Input:         w.floats(times, "SCALAR", 1, 0, true),
+				Output:        w.floats(weights, "SCALAR", 1, 0, false),
+				Interpolation: "LINEAR",
+			}},
+		})
+	}
+}
+
+func (w *writer) write(out io.Writer) (err error) {
+	for w.bin.Len()%4 != 0 {
+		w.bin.WriteByte(0)
+	}
+
+	w.doc.Buffers = []gltfBuffer{{ByteLength: w.bin.Len()}}
+
+	var js []byte
+	if js, err = json.Marshal(&w.doc); err != nil {
+		return
+	}
+
+	for len(js)%4 != 0 {
+		js = append(js, ' ')
+	}
+
+	header := []uint32{
+		glbMagic, 2, uint32(12 + 8 + len(js) + 8 + w.bin.Len()),
+		uint32(len(js)), glbChunkJSON,
+	}
+
+	if err = binary.Write(out, binary.LittleEndian, header); err != nil {
+		return
+	} else if _, err = out.Write(js); err != nil {
+		return
+	} else if err = binary.Write(out, binary.LittleEndian, []uint32{uint32(w.bin.Len()), glbChunkBIN}); err != nil {
+		return
+	}
+
+	_, err = out.Write(w.bin.Bytes())
+
+	return
+}
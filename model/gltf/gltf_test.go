@@ -0,0 +1,153 @@
+package gltf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"github.com/ftrvxmtrx/groke/model/md2"
+	"github.com/ftrvxmtrx/groke/model/mdl"
+	"github.com/ftrvxmtrx/groke/model/vertexanim"
+	"image"
+	"image/color"
+	"testing"
+)
+
+func testMDL() *mdl.Model {
+	frame := func(name string, z float64) mdl.Frame {
+		return mdl.Frame{
+			Name: name,
+			Verts: []mdl.Vertex{
+				{Pos: mdl.Vector3{0, 0, z}, Normal: vertexanim.Normals[0]},
+				{Pos: mdl.Vector3{1, 0, z}, Normal: vertexanim.Normals[1]},
+				{Pos: mdl.Vector3{0, 1, z}, Normal: vertexanim.Normals[2]},
+			},
+		}
+	}
+
+	skin := image.NewPaletted(image.Rect(0, 0, 4, 2), color.Palette{color.Black, color.White})
+
+	return &mdl.Model{
+		SkinWidth:  4,
+		SkinHeight: 2,
+		Skins:      []mdl.Skin{{Images: []*image.Paletted{skin}}},
+		TexCoords:  []mdl.TexCoord{{S: 0, T: 0}, {OnSeam: true, S: 1, T: 0}, {S: 1, T: 1}},
+		Triangles: []mdl.Triangle{
+			{FacesFront: true, Verts: [3]int{0, 1, 2}},
+			{FacesFront: false, Verts: [3]int{2, 1, 0}},
+		},
+		Frames: []mdl.FrameGroup{
+			{Frames: []mdl.Frame{frame("stand1", 0)}},
+			{Frames: []mdl.Frame{frame("stand2", 1)}},
+			{Frames: []mdl.Frame{frame("run1", 2), frame("run2", 3)}, Times: []float64{0.25, 0.75}},
+		},
+	}
+}
+
+func readGLB(t *testing.T, b []byte) (doc gltfDocument, bin []byte) {
+	var h [5]uint32
+	if err := binary.Read(bytes.NewReader(b), binary.LittleEndian, &h); err != nil {
+		t.Fatal(err)
+	}
+
+	if h[0] != glbMagic || h[1] != 2 || int(h[2]) != len(b) || h[4] != glbChunkJSON || h[3]%4 != 0 {
+		t.Fatalf("bad glb header %x", h)
+	}
+
+	js := b[20 : 20+h[3]]
+	if err := json.Unmarshal(js, &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	bin = b[20+h[3]+8:]
+	if binary.LittleEndian.Uint32(b[20+h[3]+4:]) != glbChunkBIN || len(bin) != doc.Buffers[0].ByteLength {
+		t.Fatalf("bad binary chunk")
+	}
+
+	return
+}
+
+func TestFromMDL(t *testing.T) {
+	m := FromMDL("test", testMDL())
+
+	// the seam vertex is split for the back facing triangle
+	if len(m.TexCoords) != 4 || len(m.Frames) != 4 || len(m.Frames[3].Pos) != 4 {
+		t.Fatalf("bad remap %+v", m)
+	}
+
+	if m.TexCoords[1] != [2]float64{1.5 / 4, 0.25} || m.TexCoords[3] != [2]float64{3.5 / 4, 0.25} {
+		t.Errorf("bad texcoords %v", m.TexCoords)
+	}
+
+	if m.Triangles[0] != [3]int{0, 2, 1} {
+		t.Errorf("winding not reversed %v", m.Triangles)
+	}
+
+	if want := []float64{FrameTime, FrameTime, 0.25, 0.5}; len(m.Durations) != 4 || m.Durations[3] != want[3] || m.Durations[2] != want[2] {
+		t.Errorf("expected durations %v, got %v", want, m.Durations)
+	}
+}
+
+func TestFromMD2(t *testing.T) {
+	in := &md2.Model{
+		SkinWidth:  2,
+		SkinHeight: 2,
+		TexCoords:  []md2.TexCoord{{S: 0, T: 0}, {S: 2, T: 0}, {S: 0, T: 2}, {S: 1, T: 1}},
+		Triangles: []md2.Triangle{
+			{Verts: [3]int{0, 1, 2}, TexCoords: [3]int{0, 1, 2}},
+			{Verts: [3]int{0, 2, 1}, TexCoords: [3]int{3, 2, 1}},
+		},
+		Frames: []md2.Frame{{Name: "frame1", Verts: make([]md2.Vertex, 3)}},
+	}
+
+	m := FromMD2("test", in, nil)
+	if len(m.TexCoords) != 4 || m.TexCoords[3] != [2]float64{0.5, 0.5} || m.Triangles[1] != [3]int{3, 1, 2} {
+		t.Errorf("bad remap %+v", m)
+	}
+}
+
+func TestWrite(t *testing.T) {
+	var a, b bytes.Buffer
+	if err := Write(&a, FromMDL("test", testMDL())); err != nil {
+		t.Fatal(err)
+	} else if err = Write(&b, FromMDL("test", testMDL())); err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(a.Bytes(), b.Bytes()) {
+		t.Fatalf("output is not deterministic")
+	}
+
+	doc, bin := readGLB(t, a.Bytes())
+
+	if len(doc.Meshes) != 1 || len(doc.Meshes[0].Primitives[0].Targets) != 4 {
+		t.Fatalf("bad meshes %+v", doc.Meshes)
+	}
+
+	if names := doc.Meshes[0].Extras.TargetNames; len(names) != 4 || names[2] != "run1" {
+		t.Errorf("bad target names %v", names)
+	}
+
+	if len(doc.Images) != 1 || !bytes.HasPrefix(bin[doc.BufferViews[doc.Images[0].BufferView].ByteOffset:], []byte("\x89PNG")) {
+		t.Errorf("skin not embedded")
+	}
+
+	// Quake Z is glTF Y
+	pos := doc.Accessors[doc.Meshes[0].Primitives[0].Targets[3]["POSITION"]]
+	if pos.Min[1] != 3 || pos.Max[1] != 3 {
+		t.Errorf("bad target bounds %v %v", pos.Min, pos.Max)
+	}
+
+	if len(doc.Animations) != 2 || doc.Animations[0].Name != "stand" || doc.Animations[1].Name != "run" {
+		t.Fatalf("bad animations %+v", doc.Animations)
+	}
+
+	input := doc.Accessors[doc.Animations[1].Samplers[0].Input]
+	output := doc.Accessors[doc.Animations[1].Samplers[0].Output]
+	if input.Count != 3 || input.Max[0] != 0.75 || output.Count != 3*4 {
+		t.Errorf("bad run animation %+v %+v", input, output)
+	}
+
+	if err := Write(&a, &Model{}); err != ErrEmpty {
+		t.Errorf("expected ErrEmpty, got %v", err)
+	}
+}
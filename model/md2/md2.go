@@ -0,0 +1,390 @@
+/*
+Package md2 provides support for reading Quake2 models (models/*.md2).
+*/
+package md2
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"github.com/ftrvxmtrx/groke/image/pcx"
+	"github.com/ftrvxmtrx/groke/model/vertexanim"
+	"image"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"strings"
+)
+
+type Vector3 = vertexanim.Vector3
+
+// TexCoord is a skin coordinate in pixels.
+type TexCoord struct {
+	S, T int
+}
+
+type Triangle struct {
+	Verts     [3]int // indices into Frame.Verts
+	TexCoords [3]int // indices into Model.TexCoords
+}
+
+type Vertex struct {
+	Pos         Vector3
+	Normal      Vector3
+	NormalIndex uint8
+}
+
+type Frame struct {
+	Name      string
+	Scale     Vector3
+	Translate Vector3
+	Verts     []Vertex
+}
+
+// GLVertex is a vertex of a GL command, with texture coordinates already
+// normalized to 0..1.
+type GLVertex struct {
+	S, T float64
+	Vert int // index into Frame.Verts
+}
+
+// GLCommand is a triangle strip or a triangle fan.
+type GLCommand struct {
+	Fan   bool
+	Verts []GLVertex
+}
+
+type Model struct {
+	SkinWidth  int
+	SkinHeight int
+	Skins      []string
+	TexCoords  []TexCoord
+	Triangles  []Triangle
+	Frames     []Frame
+	GLCommands []GLCommand
+}
+
+const (
+	NoGLCommands = 1 << iota
+)
+
+var (
+	ErrFormat = errors.New("md2: invalid md2 format")
+)
+
+type md2Header struct {
+	Id         [4]byte
+	Version    int32
+	SkinWidth  int32
+	SkinHeight int32
+	FrameSize  int32
+	NumSkins   int32
+	NumVerts   int32
+	NumST      int32
+	NumTris    int32
+	NumGLCmds  int32
+	NumFrames  int32
+	OfsSkins   int32
+	OfsST      int32
+	OfsTris    int32
+	OfsFrames  int32
+	OfsGLCmds  int32
+	OfsEnd     int32
+}
+
+type md2TexCoord struct {
+	S, T int16
+}
+
+type md2Triangle struct {
+	Verts     [3]uint16
+	TexCoords [3]uint16
+}
+
+type md2FrameHeader struct {
+	Scale     [3]float32
+	Translate [3]float32
+	Name      [16]byte
+}
+
+type md2GLVertex struct {
+	S, T float32
+	Vert int32
+}
+
+// section returns a reader of n items of the given size at offset.
+func section(b []byte, offset, n, size int32) (*bytes.Reader, error) {
+	if offset < 0 || n < 0 || size < 0 || int64(offset)+int64(n)*int64(size) > int64(len(b)) {
+		return nil, ErrFormat
+	}
+
+	return bytes.NewReader(b[offset:]), nil
+}
+
+func read(r io.Reader, data interface{}) error {
+	if err := binary.Read(r, binary.LittleEndian, data); err != nil {
+		return ErrFormat
+	}
+
+	return nil
+}
+
+// Read reads a model.
+func Read(r io.Reader, flags int) (m *Model, err error) {
+	var b []byte
+	if b, err = ioutil.ReadAll(r); err != nil {
+		return
+	}
+
+	var h md2Header
+	if err = read(bytes.NewReader(b), &h); err != nil {
+		return
+	} else if h.Id != [4]byte{'I', 'D', 'P', '2'} || h.Version != 8 {
+		err = ErrFormat
+		return
+	}
+
+	m = &Model{
+		SkinWidth:  int(h.SkinWidth),
+		SkinHeight: int(h.SkinHeight),
+	}
+
+	if m.Skins, err = readSkins(b, &h); err != nil {
+		return nil, err
+	} else if m.TexCoords, err = readTexCoords(b, &h); err != nil {
+		return nil, err
+	} else if m.Triangles, err = readTriangles(b, &h); err != nil {
+		return nil, err
+	} else if m.Frames, err = readFrames(b, &h); err != nil {
+		return nil, err
+	}
+
+	if flags&NoGLCommands == 0 {
+		if m.GLCommands, err = readGLCommands(b, &h); err != nil {
+			return nil, err
+		}
+	}
+
+	return
+}
+
+func readSkins(b []byte, h *md2Header) (skins []string, err error) {
+	var r *bytes.Reader
+	if r, err = section(b, h.OfsSkins, h.NumSkins, 64); err != nil {
+		return
+	}
+
+	names := make([][64]byte, h.NumSkins)
+	if err = read(r, names); err != nil {
+		return
+	}
+
+	skins = make([]string, len(names))
+	for i := range names {
+		skins[i] = cString(names[i][:])
+	}
+
+	return
+}
+
+func readTexCoords(b []byte, h *md2Header) (tcs []TexCoord, err error) {
+	var r *bytes.Reader
+	if r, err = section(b, h.OfsST, h.NumST, 4); err != nil {
+		return
+	}
+
+	st := make([]md2TexCoord, h.NumST)
+	if err = read(r, st); err != nil {
+		return
+	}
+
+	tcs = make([]TexCoord, len(st))
+	for i, tc := range st {
+		tcs[i] = TexCoord{S: int(tc.S), T: int(tc.T)}
+	}
+
+	return
+}
+
+func readTriangles(b []byte, h *md2Header) (tris []Triangle, err error) {
+	var r *bytes.Reader
+	if r, err = section(b, h.OfsTris, h.NumTris, 12); err != nil {
+		return
+	}
+
+	tris16 := make([]md2Triangle, h.NumTris)
+	if err = read(r, tris16); err != nil {
+		return
+	}
+
+	tris = make([]Triangle, len(tris16))
+	for i, t := range tris16 {
+		for j := 0; j < 3; j++ {
+			if int32(t.Verts[j]) >= h.NumVerts || int32(t.TexCoords[j]) >= h.NumST {
+				return nil, ErrFormat
+			}
+
+			tris[i].Verts[j] = int(t.Verts[j])
+			tris[i].TexCoords[j] = int(t.TexCoords[j])
+		}
+	}
+
+	return
+}
+
+func readFrames(b []byte, h *md2Header) (frames []Frame, err error) {
+	// computed in int64 so NumVerts can not wrap the frame size around
+	if h.NumVerts < 0 || int64(h.FrameSize) < 40+4*int64(h.NumVerts) {
+		return nil, ErrFormat
+	}
+
+	if _, err = section(b, h.OfsFrames, h.NumFrames, h.FrameSize); err != nil {
+		return
+	}
+
+	frames = make([]Frame, h.NumFrames)
+	if len(frames) == 0 {
+		// NumVerts is only bounded by the data of a frame
+		return
+	}
+
+	verts := make([]vertexanim.Vertex, h.NumVerts)
+
+	for i := range frames {
+		r := bytes.NewReader(b[int64(h.OfsFrames)+int64(i)*int64(h.FrameSize):])
+
+		var fh md2FrameHeader
+		if err = read(r, &fh); err != nil {
+			return
+		} else if err = read(r, verts); err != nil {
+			return
+		}
+
+		f := Frame{
+			Name:      cString(fh.Name[:]),
+			Scale:     vector3(fh.Scale),
+			Translate: vector3(fh.Translate),
+			Verts:     make([]Vertex, len(verts)),
+		}
+
+		for j, v := range verts {
+			out := &f.Verts[j]
+			out.Pos, out.Normal = v.Decode(f.Scale, f.Translate)
+			out.NormalIndex = v.NormalIndex
+		}
+
+		frames[i] = f
+	}
+
+	return
+}
+
+func readGLCommands(b []byte, h *md2Header) (cmds []GLCommand, err error) {
+	if _, err = section(b, h.OfsGLCmds, h.NumGLCmds, 4); err != nil {
+		return
+	}
+
+	r := bytes.NewReader(b[h.OfsGLCmds : h.OfsGLCmds+4*h.NumGLCmds])
+
+	for {
+		var n int32
+		if err = read(r, &n); err != nil {
+			return
+		} else if n == 0 {
+			break
+		}
+
+		cmd := GLCommand{Fan: n < 0}
+		if n < 0 {
+			n = -n
+		}
+
+		if int64(n)*12 > int64(r.Len()) {
+			return nil, ErrFormat
+		}
+
+		glverts := make([]md2GLVertex, n)
+		if err = read(r, glverts); err != nil {
+			return
+		}
+
+		cmd.Verts = make([]GLVertex, n)
+		for i, v := range glverts {
+			if v.Vert < 0 || v.Vert >= h.NumVerts {
+				return nil, ErrFormat
+			}
+
+			cmd.Verts[i] = GLVertex{
+				S:    float64(v.S),
+				T:    float64(v.T),
+				Vert: int(v.Vert),
+			}
+		}
+
+		cmds = append(cmds, cmd)
+	}
+
+	return
+}
+
+// LoadSkins loads the pcx skins referenced by the model from fsys. Skin
+// names are paths relative to the game directory, with a leading slash
+// removed if any.
+func (m *Model) LoadSkins(fsys fs.FS) (skins []image.Image, err error) {
+	skins = make([]image.Image, 0, len(m.Skins))
+
+	for _, name := range m.Skins {
+		var f fs.File
+		if f, err = fsys.Open(strings.TrimLeft(name, "/")); err != nil {
+			return nil, err
+		}
+
+		var im image.Image
+		im, err = pcx.Decode(f)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		skins = append(skins, im)
+	}
+
+	return
+}
+
+// AnimFrames returns all frames for use with vertexanim.
+func (m *Model) AnimFrames() (frames []vertexanim.Frame) {
+	frames = make([]vertexanim.Frame, len(m.Frames))
+	for i := range m.Frames {
+		frames[i] = m.Frames[i].animFrame()
+	}
+
+	return
+}
+
+func (f *Frame) animFrame() (out vertexanim.Frame) {
+	out = vertexanim.Frame{
+		Name:    f.Name,
+		Pos:     make([]Vector3, len(f.Verts)),
+		Normals: make([]Vector3, len(f.Verts)),
+	}
+
+	for i, v := range f.Verts {
+		out.Pos[i] = v.Pos
+		out.Normals[i] = v.Normal
+	}
+
+	return
+}
+
+func cString(b []byte) string {
+	if n := bytes.IndexByte(b, 0); n >= 0 {
+		b = b[:n]
+	}
+
+	return string(b)
+}
+
+func vector3(v [3]float32) Vector3 {
+	return Vector3{float64(v[0]), float64(v[1]), float64(v[2])}
+}
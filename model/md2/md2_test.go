@@ -0,0 +1,185 @@
+package md2
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/ftrvxmtrx/groke/model/vertexanim"
+	"runtime"
+	"testing"
+	"testing/fstest"
+)
+
+func buildMD2() []byte {
+	var body bytes.Buffer
+	w := func(v interface{}) { binary.Write(&body, binary.LittleEndian, v) }
+
+	const headerLen = 68
+	h := md2Header{
+		Id:         [4]byte{'I', 'D', 'P', '2'},
+		Version:    8,
+		SkinWidth:  2,
+		SkinHeight: 1,
+		FrameSize:  40 + 4*3,
+		NumSkins:   1,
+		NumVerts:   3,
+		NumST:      3,
+		NumTris:    1,
+		NumFrames:  2,
+	}
+
+	h.OfsSkins = headerLen
+	var skin [64]byte
+	copy(skin[:], "models/test/skin.pcx")
+	w(skin)
+
+	h.OfsST = headerLen + int32(body.Len())
+	w([]md2TexCoord{{0, 0}, {2, 0}, {0, 1}})
+
+	h.OfsTris = headerLen + int32(body.Len())
+	w(md2Triangle{[3]uint16{0, 1, 2}, [3]uint16{2, 1, 0}})
+
+	h.OfsFrames = headerLen + int32(body.Len())
+	for i, name := range []string{"stand1", "stand2"} {
+		fh := md2FrameHeader{
+			Scale:     [3]float32{0.5, 1, 2},
+			Translate: [3]float32{float32(i), 0, -1},
+		}
+		copy(fh.Name[:], name)
+		w(fh)
+		w([]vertexanim.Vertex{{V: [3]uint8{0, 0, 0}, NormalIndex: 0}, {V: [3]uint8{2, 4, 6}, NormalIndex: 7}, {V: [3]uint8{1, 1, 1}, NormalIndex: 161}})
+	}
+
+	h.OfsGLCmds = headerLen + int32(body.Len())
+	start := body.Len()
+	w(int32(3))
+	w([]md2GLVertex{{0, 0, 0}, {1, 0, 1}, {0, 1, 2}})
+	w(int32(-3))
+	w([]md2GLVertex{{0, 1, 2}, {1, 0, 1}, {0, 0, 0}})
+	w(int32(0))
+	h.NumGLCmds = int32(body.Len()-start) / 4
+	h.OfsEnd = headerLen + int32(body.Len())
+
+	var b bytes.Buffer
+	binary.Write(&b, binary.LittleEndian, h)
+	b.Write(body.Bytes())
+
+	return b.Bytes()
+}
+
+func TestReadSynthetic(t *testing.T) {
+	m, err := Read(bytes.NewReader(buildMD2()), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(m.Skins) != 1 || m.Skins[0] != "models/test/skin.pcx" {
+		t.Errorf("bad skins %q", m.Skins)
+	}
+
+	if m.TexCoords[1] != (TexCoord{2, 0}) {
+		t.Errorf("bad texcoords %+v", m.TexCoords)
+	}
+
+	if m.Triangles[0] != (Triangle{[3]int{0, 1, 2}, [3]int{2, 1, 0}}) {
+		t.Errorf("bad triangle %+v", m.Triangles[0])
+	}
+
+	if len(m.Frames) != 2 || m.Frames[1].Name != "stand2" {
+		t.Fatalf("bad frames %+v", m.Frames)
+	}
+
+	if v := m.Frames[1].Verts[1]; v.Pos != (Vector3{2, 4, 11}) || v.Normal != vertexanim.Normals[7] {
+		t.Errorf("bad vertex %+v", v)
+	}
+
+	if len(m.GLCommands) != 2 || m.GLCommands[0].Fan || !m.GLCommands[1].Fan {
+		t.Fatalf("bad gl commands %+v", m.GLCommands)
+	}
+
+	if v := m.GLCommands[1].Verts[0]; v != (GLVertex{0, 1, 2}) {
+		t.Errorf("bad gl vertex %+v", v)
+	}
+
+	if m, err = Read(bytes.NewReader(buildMD2()), NoGLCommands); err != nil {
+		t.Fatal(err)
+	} else if m.GLCommands != nil {
+		t.Errorf("gl commands loaded with NoGLCommands")
+	}
+
+	b := buildMD2()
+	if _, err = Read(bytes.NewReader(b[:len(b)-8]), 0); err != ErrFormat {
+		t.Errorf("truncated: expected ErrFormat, got %v", err)
+	}
+}
+
+func TestLoadSkins(t *testing.T) {
+	pcx := make([]byte, 128)
+	pcx[2], pcx[3] = 1, 8
+	pcx[8] = 1 // width-1
+	pcx = append(pcx, 5, 0xc1, 0xc8, 12)
+	pcx = append(pcx, make([]byte, 768)...)
+
+	fsys := fstest.MapFS{
+		"models/test/skin.pcx": {Data: pcx},
+	}
+
+	m, err := Read(bytes.NewReader(buildMD2()), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	skins, err := m.LoadSkins(fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(skins) != 1 || skins[0].Bounds().Dx() != 2 {
+		t.Errorf("bad skins %v", skins)
+	}
+
+	delete(fsys, "models/test/skin.pcx")
+	if _, err = m.LoadSkins(fsys); err == nil {
+		t.Errorf("missing skin loaded")
+	}
+}
+
+func TestReadOverflow(t *testing.T) {
+	// 40+4*NumVerts wraps around to 8 in int32, which used to allocate
+	// the vertices before failing
+	b := buildMD2()
+	binary.LittleEndian.PutUint32(b[24:], 0x3ffffff8)
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	if _, err := Read(bytes.NewReader(b), 0); err != ErrFormat {
+		t.Errorf("expected ErrFormat, got %v", err)
+	}
+	runtime.ReadMemStats(&after)
+	if n := after.TotalAlloc - before.TotalAlloc; n > 1<<20 {
+		t.Errorf("%d bytes allocated", n)
+	}
+
+	// no frames to bound a huge NumVerts
+	b = buildMD2()
+	binary.LittleEndian.PutUint32(b[16:], 0x7fffffff)
+	binary.LittleEndian.PutUint32(b[24:], 0x1ffffff0)
+	binary.LittleEndian.PutUint32(b[40:], 0)
+
+	runtime.ReadMemStats(&before)
+	if m, err := Read(bytes.NewReader(b), 0); err != nil {
+		t.Error(err)
+	} else if len(m.Frames) != 0 {
+		t.Errorf("got %d frames", len(m.Frames))
+	}
+	runtime.ReadMemStats(&after)
+	if n := after.TotalAlloc - before.TotalAlloc; n > 1<<20 {
+		t.Errorf("no frames: %d bytes allocated", n)
+	}
+
+	// negative frame size
+	b = buildMD2()
+	binary.LittleEndian.PutUint32(b[16:], 0xffffffff)
+	if _, err := Read(bytes.NewReader(b), 0); err != ErrFormat {
+		t.Errorf("expected ErrFormat, got %v", err)
+	}
+}
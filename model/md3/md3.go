@@ -0,0 +1,376 @@
+/*
+Package md3 provides support for reading Quake3 models (models/*.md3).
+*/
+package md3
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math"
+)
+
+type Vector3 [3]float64
+
+type Frame struct {
+	Name   string
+	Min    Vector3
+	Max    Vector3
+	Origin Vector3
+	Radius float64
+}
+
+// Tag is an attachment point, such as "tag_weapon" or "tag_head".
+type Tag struct {
+	Name   string
+	Origin Vector3
+	Axis   [3]Vector3
+}
+
+type Shader struct {
+	Name  string
+	Index int
+}
+
+type Vertex struct {
+	Pos    Vector3
+	Normal Vector3
+}
+
+type Surface struct {
+	Name      string
+	Flags     uint32
+	Shaders   []Shader
+	Triangles [][3]int
+	TexCoords [][2]float64 // one per vertex
+	Frames    [][]Vertex   // vertices per frame
+}
+
+type Model struct {
+	Name     string
+	Flags    uint32
+	Frames   []Frame
+	Tags     [][]Tag // tags per frame
+	Surfaces []Surface
+}
+
+const (
+	FirstFrameOnly = 1 << iota // only read vertices and tags of the first frame
+)
+
+var (
+	ErrFormat = errors.New("md3: invalid md3 format")
+)
+
+// XYZScale is the size of a unit of vertex coordinates.
+const XYZScale = 1.0 / 64
+
+type md3Header struct {
+	Id          [4]byte
+	Version     int32
+	Name        [64]byte
+	Flags       uint32
+	NumFrames   int32
+	NumTags     int32
+	NumSurfaces int32
+	NumSkins    int32
+	OfsFrames   int32
+	OfsTags     int32
+	OfsSurfaces int32
+	OfsEnd      int32
+}
+
+type md3Frame struct {
+	Min    [3]float32
+	Max    [3]float32
+	Origin [3]float32
+	Radius float32
+	Name   [16]byte
+}
+
+type md3Tag struct {
+	Name   [64]byte
+	Origin [3]float32
+	Axis   [3][3]float32
+}
+
+type md3Surface struct {
+	Id           [4]byte
+	Name         [64]byte
+	Flags        uint32
+	NumFrames    int32
+	NumShaders   int32
+	NumVerts     int32
+	NumTriangles int32
+	OfsTriangles int32
+	OfsShaders   int32
+	OfsST        int32
+	OfsVerts     int32
+	OfsEnd       int32
+}
+
+type md3Shader struct {
+	Name  [64]byte
+	Index int32
+}
+
+type md3Vertex struct {
+	Pos    [3]int16
+	Normal uint16
+}
+
+// section returns a reader of n items of the given size at offset. Counts
+// are int64 so products of header values can not wrap around.
+func section(b []byte, offset int32, n int64, size int32) (*bytes.Reader, error) {
+	if offset < 0 || n < 0 || size <= 0 || n > int64(len(b)) || int64(offset)+n*int64(size) > int64(len(b)) {
+		return nil, ErrFormat
+	}
+
+	return bytes.NewReader(b[offset:]), nil
+}
+
+func read(r io.Reader, data interface{}) error {
+	if err := binary.Read(r, binary.LittleEndian, data); err != nil {
+		return ErrFormat
+	}
+
+	return nil
+}
+
+// Read reads a model.
+func Read(r io.Reader, flags int) (m *Model, err error) {
+	var b []byte
+	if b, err = ioutil.ReadAll(r); err != nil {
+		return
+	}
+
+	var h md3Header
+	if err = read(bytes.NewReader(b), &h); err != nil {
+		return
+	} else if h.Id != [4]byte{'I', 'D', 'P', '3'} || h.Version != 15 || h.NumFrames < 1 {
+		err = ErrFormat
+		return
+	}
+
+	m = &Model{
+		Name:  cString(h.Name[:]),
+		Flags: h.Flags,
+	}
+
+	numFrames := h.NumFrames
+	if flags&FirstFrameOnly != 0 {
+		numFrames = 1
+	}
+
+	if m.Frames, err = readFrames(b, &h); err != nil {
+		return nil, err
+	} else if m.Tags, err = readTags(b, &h, numFrames); err != nil {
+		return nil, err
+	}
+
+	if h.NumSurfaces < 0 {
+		return nil, ErrFormat
+	}
+
+	m.Surfaces = make([]Surface, h.NumSurfaces)
+	offset := h.OfsSurfaces
+	for i := range m.Surfaces {
+		if offset < 0 || int(offset) > len(b) {
+			return nil, ErrFormat
+		}
+
+		var size int32
+		if m.Surfaces[i], size, err = readSurface(b[offset:], numFrames); err != nil {
+			return nil, err
+		}
+		offset += size
+	}
+
+	return
+}
+
+func readFrames(b []byte, h *md3Header) (frames []Frame, err error) {
+	var r *bytes.Reader
+	if r, err = section(b, h.OfsFrames, int64(h.NumFrames), 56); err != nil {
+		return
+	}
+
+	raw := make([]md3Frame, h.NumFrames)
+	if err = read(r, raw); err != nil {
+		return
+	}
+
+	frames = make([]Frame, len(raw))
+	for i, f := range raw {
+		frames[i] = Frame{
+			Name:   cString(f.Name[:]),
+			Min:    vector3(f.Min),
+			Max:    vector3(f.Max),
+			Origin: vector3(f.Origin),
+			Radius: float64(f.Radius),
+		}
+	}
+
+	return
+}
+
+func readTags(b []byte, h *md3Header, numFrames int32) (tags [][]Tag, err error) {
+	// a single frame of tags has to fit even if no frames are read
+	var r *bytes.Reader
+	if _, err = section(b, h.OfsTags, int64(h.NumTags), 112); err != nil {
+		return
+	} else if r, err = section(b, h.OfsTags, int64(numFrames)*int64(h.NumTags), 112); err != nil {
+		return
+	}
+
+	raw := make([]md3Tag, h.NumTags)
+	tags = make([][]Tag, numFrames)
+	for i := range tags {
+		if err = read(r, raw); err != nil {
+			return
+		}
+
+		tags[i] = make([]Tag, len(raw))
+		for j, t := range raw {
+			tags[i][j] = Tag{
+				Name:   cString(t.Name[:]),
+				Origin: vector3(t.Origin),
+				Axis:   [3]Vector3{vector3(t.Axis[0]), vector3(t.Axis[1]), vector3(t.Axis[2])},
+			}
+		}
+	}
+
+	return
+}
+
+// readSurface reads a surface at the start of b, returning its size.
+func readSurface(b []byte, numFrames int32) (s Surface, size int32, err error) {
+	var h md3Surface
+	if err = read(bytes.NewReader(b), &h); err != nil {
+		return
+	} else if h.Id != [4]byte{'I', 'D', 'P', '3'} || h.NumFrames < numFrames || h.NumVerts < 0 {
+		err = ErrFormat
+		return
+	}
+
+	s = Surface{
+		Name:  cString(h.Name[:]),
+		Flags: h.Flags,
+	}
+
+	var r *bytes.Reader
+
+	// shaders
+	if r, err = section(b, h.OfsShaders, int64(h.NumShaders), 68); err != nil {
+		return
+	}
+
+	shaders := make([]md3Shader, h.NumShaders)
+	if err = read(r, shaders); err != nil {
+		return
+	}
+
+	s.Shaders = make([]Shader, len(shaders))
+	for i, sh := range shaders {
+		s.Shaders[i] = Shader{
+			Name:  cString(sh.Name[:]),
+			Index: int(sh.Index),
+		}
+	}
+
+	// triangles
+	if r, err = section(b, h.OfsTriangles, int64(h.NumTriangles), 12); err != nil {
+		return
+	}
+
+	tris := make([][3]int32, h.NumTriangles)
+	if err = read(r, tris); err != nil {
+		return
+	}
+
+	s.Triangles = make([][3]int, len(tris))
+	for i, t := range tris {
+		for j, v := range t {
+			if v < 0 || v >= h.NumVerts {
+				err = ErrFormat
+				return
+			}
+			s.Triangles[i][j] = int(v)
+		}
+	}
+
+	// texture coordinates
+	if r, err = section(b, h.OfsST, int64(h.NumVerts), 8); err != nil {
+		return
+	}
+
+	st := make([][2]float32, h.NumVerts)
+	if err = read(r, st); err != nil {
+		return
+	}
+
+	s.TexCoords = make([][2]float64, len(st))
+	for i, tc := range st {
+		s.TexCoords[i] = [2]float64{float64(tc[0]), float64(tc[1])}
+	}
+
+	// vertices
+	if r, err = section(b, h.OfsVerts, int64(numFrames)*int64(h.NumVerts), 8); err != nil {
+		return
+	}
+
+	verts := make([]md3Vertex, h.NumVerts)
+	s.Frames = make([][]Vertex, numFrames)
+	for i := range s.Frames {
+		if err = read(r, verts); err != nil {
+			return
+		}
+
+		s.Frames[i] = make([]Vertex, len(verts))
+		for j, v := range verts {
+			s.Frames[i][j] = Vertex{
+				Pos: Vector3{
+					float64(v.Pos[0]) * XYZScale,
+					float64(v.Pos[1]) * XYZScale,
+					float64(v.Pos[2]) * XYZScale,
+				},
+				Normal: DecodeNormal(v.Normal),
+			}
+		}
+	}
+
+	if h.OfsEnd <= 0 || int(h.OfsEnd) > len(b) {
+		err = ErrFormat
+		return
+	}
+	size = h.OfsEnd
+
+	return
+}
+
+// DecodeNormal decodes a normal packed as latitude (high byte) and
+// longitude (low byte).
+func DecodeNormal(n uint16) Vector3 {
+	lat := float64(n>>8) * (2 * math.Pi / 255)
+	lng := float64(n&0xff) * (2 * math.Pi / 255)
+
+	return Vector3{
+		math.Cos(lat) * math.Sin(lng),
+		math.Sin(lat) * math.Sin(lng),
+		math.Cos(lng),
+	}
+}
+
+func cString(b []byte) string {
+	if n := bytes.IndexByte(b, 0); n >= 0 {
+		b = b[:n]
+	}
+
+	return string(b)
+}
+
+func vector3(v [3]float32) Vector3 {
+	return Vector3{float64(v[0]), float64(v[1]), float64(v[2])}
+}
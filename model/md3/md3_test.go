@@ -0,0 +1,181 @@
+package md3
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+)
+
+func buildSurface(numFrames int32) []byte {
+	var body bytes.Buffer
+	w := func(v interface{}) { binary.Write(&body, binary.LittleEndian, v) }
+
+	const headerLen = 108
+	h := md3Surface{
+		Id:           [4]byte{'I', 'D', 'P', '3'},
+		NumFrames:    numFrames,
+		NumShaders:   1,
+		NumVerts:     3,
+		NumTriangles: 1,
+	}
+	copy(h.Name[:], "h_head")
+
+	h.OfsShaders = headerLen
+	sh := md3Shader{Index: 0}
+	copy(sh.Name[:], "models/players/test/head.tga")
+	w(sh)
+
+	h.OfsTriangles = headerLen + int32(body.Len())
+	w([3]int32{0, 2, 1})
+
+	h.OfsST = headerLen + int32(body.Len())
+	w([][2]float32{{0, 0}, {1, 0}, {0.5, 1}})
+
+	h.OfsVerts = headerLen + int32(body.Len())
+	for i := int32(0); i < numFrames; i++ {
+		w([]md3Vertex{
+			{[3]int16{0, 0, 0}, 0},
+			{[3]int16{64, 0, int16(-128 * i)}, 0},
+			{[3]int16{0, 32, 0}, 64 << 8},
+		})
+	}
+	h.OfsEnd = headerLen + int32(body.Len())
+
+	var b bytes.Buffer
+	binary.Write(&b, binary.LittleEndian, h)
+	b.Write(body.Bytes())
+
+	return b.Bytes()
+}
+
+func buildMD3() []byte {
+	var body bytes.Buffer
+	w := func(v interface{}) { binary.Write(&body, binary.LittleEndian, v) }
+
+	const headerLen = 108
+	h := md3Header{
+		Id:          [4]byte{'I', 'D', 'P', '3'},
+		Version:     15,
+		NumFrames:   2,
+		NumTags:     1,
+		NumSurfaces: 2,
+	}
+	copy(h.Name[:], "test.md3")
+
+	h.OfsFrames = headerLen
+	for i, name := range []string{"frame0", "frame1"} {
+		f := md3Frame{
+			Min:    [3]float32{-1, -1, -2},
+			Max:    [3]float32{1, 1, float32(i)},
+			Radius: 2,
+		}
+		copy(f.Name[:], name)
+		w(f)
+	}
+
+	h.OfsTags = headerLen + int32(body.Len())
+	for i := 0; i < 2; i++ {
+		t := md3Tag{
+			Origin: [3]float32{0, 0, float32(i)},
+			Axis:   [3][3]float32{{1, 0, 0}, {0, 1, 0}, {0, 0, 1}},
+		}
+		copy(t.Name[:], "tag_head")
+		w(t)
+	}
+
+	h.OfsSurfaces = headerLen + int32(body.Len())
+	w(buildSurface(2))
+	w(buildSurface(2))
+	h.OfsEnd = headerLen + int32(body.Len())
+
+	var b bytes.Buffer
+	binary.Write(&b, binary.LittleEndian, h)
+	b.Write(body.Bytes())
+
+	return b.Bytes()
+}
+
+func TestReadSynthetic(t *testing.T) {
+	m, err := Read(bytes.NewReader(buildMD3()), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if m.Name != "test.md3" || len(m.Frames) != 2 || m.Frames[1].Max != (Vector3{1, 1, 1}) {
+		t.Errorf("bad frames %+v", m.Frames)
+	}
+
+	if len(m.Tags) != 2 || m.Tags[1][0].Name != "tag_head" || m.Tags[1][0].Origin != (Vector3{0, 0, 1}) {
+		t.Errorf("bad tags %+v", m.Tags)
+	}
+
+	if len(m.Surfaces) != 2 {
+		t.Fatalf("expected 2 surfaces, got %d", len(m.Surfaces))
+	}
+
+	s := m.Surfaces[1]
+	if s.Name != "h_head" || s.Shaders[0].Name != "models/players/test/head.tga" {
+		t.Errorf("bad surface %+v", s)
+	}
+
+	if s.Triangles[0] != [3]int{0, 2, 1} || s.TexCoords[2] != [2]float64{0.5, 1} {
+		t.Errorf("bad triangles/uvs %+v %+v", s.Triangles, s.TexCoords)
+	}
+
+	if len(s.Frames) != 2 || s.Frames[1][1].Pos != (Vector3{1, 0, -2}) || s.Frames[0][2].Pos != (Vector3{0, 0.5, 0}) {
+		t.Errorf("bad vertices %+v", s.Frames)
+	}
+
+	if m, err = Read(bytes.NewReader(buildMD3()), FirstFrameOnly); err != nil {
+		t.Fatal(err)
+	} else if len(m.Tags) != 1 || len(m.Surfaces[0].Frames) != 1 {
+		t.Errorf("more than one frame read with FirstFrameOnly")
+	}
+
+	b := buildMD3()
+	if _, err = Read(bytes.NewReader(b[:len(b)-10]), 0); err != ErrFormat {
+		t.Errorf("truncated: expected ErrFormat, got %v", err)
+	}
+}
+
+func TestDecodeNormal(t *testing.T) {
+	near := func(a, b Vector3) bool {
+		for i := range a {
+			if math.Abs(a[i]-b[i]) > 2e-2 {
+				return false
+			}
+		}
+		return true
+	}
+
+	for _, c := range []struct {
+		n    uint16
+		want Vector3
+	}{
+		{0, Vector3{0, 0, 1}},
+		{64, Vector3{1, 0, 0}},
+		{64<<8 | 64, Vector3{0, 1, 0}},
+		{128, Vector3{0, 0, -1}},
+	} {
+		if got := DecodeNormal(c.n); !near(got, c.want) {
+			t.Errorf("%#x: expected %v, got %v", c.n, c.want, got)
+		}
+	}
+}
+
+func TestReadOverflow(t *testing.T) {
+	// 3*NumTags is 2 in int32
+	b := buildMD3()
+	binary.LittleEndian.PutUint32(b[76:], 3)
+	binary.LittleEndian.PutUint32(b[80:], 1431655766)
+	if _, err := Read(bytes.NewReader(b), 0); err != ErrFormat {
+		t.Errorf("expected ErrFormat, got %v", err)
+	}
+
+	b = buildMD3()
+	binary.LittleEndian.PutUint32(b[80:], 0xffffffff)
+	if _, err := Read(bytes.NewReader(b), 0); err != ErrFormat {
+		t.Errorf("expected ErrFormat, got %v", err)
+	}
+}
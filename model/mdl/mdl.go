@@ -0,0 +1,442 @@
+/*
+Package mdl provides support for reading Quake alias models (progs/*.mdl).
+*/
+package mdl
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"github.com/ftrvxmtrx/groke/image/lmp"
+	"github.com/ftrvxmtrx/groke/model/vertexanim"
+	"image"
+	"io"
+	"io/ioutil"
+)
+
+type Vector3 = vertexanim.Vector3
+
+// ModelFlags are effects the engine applies to entities using the model.
+type ModelFlags uint32
+
+const (
+	FlagRocket = ModelFlags(1 << iota)
+	FlagGrenade
+	FlagGib
+	FlagRotate
+	FlagTracer
+	FlagZomGib
+	FlagTracer2
+	FlagTracer3
+)
+
+type SyncType uint32
+
+const (
+	SyncOn = SyncType(iota)
+	SyncRand
+)
+
+// Skin is either a single image or a group of them animated with the given
+// intervals.
+type Skin struct {
+	Images []*image.Paletted
+	Times  []float64 // nil for single skins
+}
+
+// TexCoord is a skin coordinate in pixels. For vertices on the seam,
+// triangles facing back use S shifted by half of the skin width.
+type TexCoord struct {
+	OnSeam bool
+	S, T   int
+}
+
+type Triangle struct {
+	FacesFront bool
+	Verts      [3]int
+}
+
+type Vertex struct {
+	Pos         Vector3
+	Normal      Vector3
+	NormalIndex uint8
+}
+
+type Frame struct {
+	Name  string
+	Min   Vector3
+	Max   Vector3
+	Verts []Vertex
+}
+
+// FrameGroup is either a single frame or a group of them animated with the
+// given intervals.
+type FrameGroup struct {
+	Min    Vector3
+	Max    Vector3
+	Times  []float64 // nil for single frames
+	Frames []Frame
+}
+
+type Model struct {
+	Scale       Vector3
+	Origin      Vector3
+	Radius      float64
+	EyePosition Vector3
+	SkinWidth   int
+	SkinHeight  int
+	Skins       []Skin
+	TexCoords   []TexCoord
+	Triangles   []Triangle
+	Frames      []FrameGroup
+	SyncType    SyncType
+	Flags       ModelFlags
+	Size        float64
+}
+
+const (
+	NoSkins = 1 << iota
+)
+
+var (
+	ErrFormat = errors.New("mdl: invalid mdl format")
+)
+
+type mdlHeader struct {
+	Id          [4]byte
+	Version     int32
+	Scale       [3]float32
+	Origin      [3]float32
+	Radius      float32
+	EyePosition [3]float32
+	NumSkins    int32
+	SkinWidth   int32
+	SkinHeight  int32
+	NumVerts    int32
+	NumTris     int32
+	NumFrames   int32
+	SyncType    uint32
+	Flags       uint32
+	Size        float32
+}
+
+type mdlTexCoord struct {
+	OnSeam int32
+	S, T   int32
+}
+
+type mdlTriangle struct {
+	FacesFront int32
+	Verts      [3]int32
+}
+
+type mdlFrameHeader struct {
+	Min  vertexanim.Vertex
+	Max  vertexanim.Vertex
+	Name [16]byte
+}
+
+// reader reads little endian data from memory, failing with ErrFormat on
+// anything out of range.
+type reader struct {
+	*bytes.Reader
+}
+
+func (r reader) read(data interface{}) error {
+	if err := binary.Read(r, binary.LittleEndian, data); err != nil {
+		return ErrFormat
+	}
+
+	return nil
+}
+
+// fits checks n items of the given size can be read at all. Sizes are
+// computed in int64 so header values can not wrap around.
+func (r reader) fits(n int32, size int64) bool {
+	return n >= 0 && size >= 0 && int64(n)*size <= int64(r.Len())
+}
+
+// Read reads a model.
+func Read(r io.Reader, flags int) (m *Model, err error) {
+	var b []byte
+	if b, err = ioutil.ReadAll(r); err != nil {
+		return
+	}
+
+	rd := reader{bytes.NewReader(b)}
+
+	var h mdlHeader
+	if err = rd.read(&h); err != nil {
+		return
+	} else if h.Id != [4]byte{'I', 'D', 'P', 'O'} || h.Version != 6 {
+		err = ErrFormat
+		return
+	} else if h.SkinWidth <= 0 || h.SkinHeight <= 0 || !rd.fits(h.NumSkins, int64(h.SkinWidth)*int64(h.SkinHeight)) {
+		err = ErrFormat
+		return
+	}
+
+	m = &Model{
+		Scale:       vector3(h.Scale),
+		Origin:      vector3(h.Origin),
+		Radius:      float64(h.Radius),
+		EyePosition: vector3(h.EyePosition),
+		SkinWidth:   int(h.SkinWidth),
+		SkinHeight:  int(h.SkinHeight),
+		SyncType:    SyncType(h.SyncType),
+		Flags:       ModelFlags(h.Flags),
+		Size:        float64(h.Size),
+	}
+
+	if m.Skins, err = readSkins(rd, &h, flags); err != nil {
+		return nil, err
+	} else if m.TexCoords, err = readTexCoords(rd, &h); err != nil {
+		return nil, err
+	} else if m.Triangles, err = readTriangles(rd, &h); err != nil {
+		return nil, err
+	} else if m.Frames, err = m.readFrames(rd, &h); err != nil {
+		return nil, err
+	}
+
+	return
+}
+
+func readSkins(rd reader, h *mdlHeader, flags int) (skins []Skin, err error) {
+	size := int64(h.SkinWidth) * int64(h.SkinHeight)
+	skins = make([]Skin, 0, h.NumSkins)
+
+	readImage := func() (*image.Paletted, error) {
+		pix := make([]byte, size)
+		if _, err := io.ReadFull(rd, pix); err != nil {
+			return nil, ErrFormat
+		}
+
+		return &image.Paletted{
+			Pix:     pix,
+			Stride:  int(h.SkinWidth),
+			Rect:    image.Rect(0, 0, int(h.SkinWidth), int(h.SkinHeight)),
+			Palette: lmp.Palette,
+		}, nil
+	}
+
+	for i := 0; i < int(h.NumSkins); i++ {
+		var group int32
+		if err = rd.read(&group); err != nil {
+			return
+		}
+
+		var skin Skin
+		n := int32(1)
+
+		if group != 0 {
+			if err = rd.read(&n); err != nil {
+				return
+			} else if !rd.fits(n, 4+size) {
+				return nil, ErrFormat
+			}
+
+			if skin.Times, err = readTimes(rd, n); err != nil {
+				return
+			}
+		}
+
+		for j := int32(0); j < n; j++ {
+			var im *image.Paletted
+			if im, err = readImage(); err != nil {
+				return
+			}
+
+			if flags&NoSkins == 0 {
+				skin.Images = append(skin.Images, im)
+			}
+		}
+
+		skins = append(skins, skin)
+	}
+
+	return
+}
+
+func readTimes(rd reader, n int32) (times []float64, err error) {
+	times32 := make([]float32, n)
+	if err = rd.read(times32); err != nil {
+		return
+	}
+
+	times = make([]float64, n)
+	for i, t := range times32 {
+		times[i] = float64(t)
+	}
+
+	return
+}
+
+func readTexCoords(rd reader, h *mdlHeader) (tcs []TexCoord, err error) {
+	if !rd.fits(h.NumVerts, 12) {
+		return nil, ErrFormat
+	}
+
+	tcs32 := make([]mdlTexCoord, h.NumVerts)
+	if err = rd.read(tcs32); err != nil {
+		return
+	}
+
+	tcs = make([]TexCoord, len(tcs32))
+	for i, tc := range tcs32 {
+		tcs[i] = TexCoord{
+			OnSeam: tc.OnSeam != 0,
+			S:      int(tc.S),
+			T:      int(tc.T),
+		}
+	}
+
+	return
+}
+
+func readTriangles(rd reader, h *mdlHeader) (tris []Triangle, err error) {
+	if !rd.fits(h.NumTris, 16) {
+		return nil, ErrFormat
+	}
+
+	tris32 := make([]mdlTriangle, h.NumTris)
+	if err = rd.read(tris32); err != nil {
+		return
+	}
+
+	tris = make([]Triangle, len(tris32))
+	for i, t := range tris32 {
+		tris[i].FacesFront = t.FacesFront != 0
+		for j, v := range t.Verts {
+			if v < 0 || v >= h.NumVerts {
+				return nil, ErrFormat
+			}
+			tris[i].Verts[j] = int(v)
+		}
+	}
+
+	return
+}
+
+func (m *Model) readFrames(rd reader, h *mdlHeader) (groups []FrameGroup, err error) {
+	frameSize := 24 + 4*int64(h.NumVerts)
+	if !rd.fits(h.NumFrames, 4+frameSize) {
+		return nil, ErrFormat
+	}
+
+	groups = make([]FrameGroup, 0, h.NumFrames)
+
+	for i := 0; i < int(h.NumFrames); i++ {
+		var typ int32
+		if err = rd.read(&typ); err != nil {
+			return
+		}
+
+		var g FrameGroup
+		n := int32(1)
+
+		if typ != 0 {
+			var min, max vertexanim.Vertex
+			if err = rd.read(&n); err != nil {
+				return
+			} else if err = rd.read(&min); err != nil {
+				return
+			} else if err = rd.read(&max); err != nil {
+				return
+			} else if !rd.fits(n, 4+frameSize) {
+				return nil, ErrFormat
+			}
+
+			g.Min = m.decode(min).Pos
+			g.Max = m.decode(max).Pos
+			if g.Times, err = readTimes(rd, n); err != nil {
+				return
+			}
+		}
+
+		for j := int32(0); j < n; j++ {
+			var f Frame
+			if f, err = m.readFrame(rd, h); err != nil {
+				return
+			}
+			g.Frames = append(g.Frames, f)
+		}
+
+		if typ == 0 {
+			g.Min = g.Frames[0].Min
+			g.Max = g.Frames[0].Max
+		}
+
+		groups = append(groups, g)
+	}
+
+	return
+}
+
+func (m *Model) readFrame(rd reader, h *mdlHeader) (f Frame, err error) {
+	var fh mdlFrameHeader
+	if err = rd.read(&fh); err != nil {
+		return
+	}
+
+	verts := make([]vertexanim.Vertex, h.NumVerts)
+	if err = rd.read(verts); err != nil {
+		return
+	}
+
+	nameLen := bytes.IndexByte(fh.Name[:], 0)
+	if nameLen < 0 {
+		nameLen = len(fh.Name)
+	}
+
+	f = Frame{
+		Name:  string(fh.Name[:nameLen]),
+		Min:   m.decode(fh.Min).Pos,
+		Max:   m.decode(fh.Max).Pos,
+		Verts: make([]Vertex, len(verts)),
+	}
+
+	for i, v := range verts {
+		f.Verts[i] = m.decode(v)
+	}
+
+	return
+}
+
+// decode scales a compressed vertex into model space.
+func (m *Model) decode(v vertexanim.Vertex) (out Vertex) {
+	out.Pos, out.Normal = v.Decode(m.Scale, m.Origin)
+	out.NormalIndex = v.NormalIndex
+
+	return
+}
+
+// AnimFrames returns all frames, with frame groups flattened, for use with
+// vertexanim.
+func (m *Model) AnimFrames() (frames []vertexanim.Frame) {
+	for _, g := range m.Frames {
+		for i := range g.Frames {
+			frames = append(frames, g.Frames[i].animFrame())
+		}
+	}
+
+	return
+}
+
+func (f *Frame) animFrame() (out vertexanim.Frame) {
+	out = vertexanim.Frame{
+		Name:    f.Name,
+		Pos:     make([]Vector3, len(f.Verts)),
+		Normals: make([]Vector3, len(f.Verts)),
+	}
+
+	for i, v := range f.Verts {
+		out.Pos[i] = v.Pos
+		out.Normals[i] = v.Normal
+	}
+
+	return
+}
+
+func vector3(v [3]float32) Vector3 {
+	return Vector3{float64(v[0]), float64(v[1]), float64(v[2])}
+}
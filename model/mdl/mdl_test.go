@@ -0,0 +1,166 @@
+package mdl
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/ftrvxmtrx/groke/model/vertexanim"
+	"testing"
+)
+
+func buildMDL(groupSkin, groupFrame bool) []byte {
+	var b bytes.Buffer
+	w := func(v interface{}) { binary.Write(&b, binary.LittleEndian, v) }
+
+	w(mdlHeader{
+		Id:         [4]byte{'I', 'D', 'P', 'O'},
+		Version:    6,
+		Scale:      [3]float32{2, 2, 2},
+		Origin:     [3]float32{-10, 0, 5},
+		NumSkins:   1,
+		SkinWidth:  4,
+		SkinHeight: 2,
+		NumVerts:   3,
+		NumTris:    1,
+		NumFrames:  1,
+		Flags:      uint32(FlagRotate),
+	})
+
+	skin := []byte{0, 1, 2, 3, 4, 5, 6, 7}
+	if groupSkin {
+		w(int32(1))
+		w(int32(2))
+		w([]float32{0.1, 0.2})
+		w(skin)
+		w(skin)
+	} else {
+		w(int32(0))
+		w(skin)
+	}
+
+	w([]mdlTexCoord{{0, 0, 0}, {0x20, 1, 0}, {0, 3, 1}})
+	w(mdlTriangle{1, [3]int32{0, 1, 2}})
+
+	frame := func(name string) {
+		var fh mdlFrameHeader
+		fh.Min = vertexanim.Vertex{V: [3]uint8{0, 0, 0}}
+		fh.Max = vertexanim.Vertex{V: [3]uint8{10, 10, 10}}
+		copy(fh.Name[:], name)
+		w(fh)
+		w([]vertexanim.Vertex{{V: [3]uint8{0, 0, 0}, NormalIndex: 0}, {V: [3]uint8{10, 0, 0}, NormalIndex: 5}, {V: [3]uint8{0, 10, 10}, NormalIndex: 161}})
+	}
+
+	if groupFrame {
+		w(int32(1))
+		w(int32(2))
+		w(vertexanim.Vertex{V: [3]uint8{1, 1, 1}})
+		w(vertexanim.Vertex{V: [3]uint8{9, 9, 9}})
+		w([]float32{0.1, 0.2})
+		frame("run1")
+		frame("run2")
+	} else {
+		w(int32(0))
+		frame("stand1")
+	}
+
+	return b.Bytes()
+}
+
+func TestReadSynthetic(t *testing.T) {
+	m, err := Read(bytes.NewReader(buildMDL(false, false)), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if m.Flags != FlagRotate || len(m.Skins) != 1 || len(m.Skins[0].Images) != 1 || m.Skins[0].Times != nil {
+		t.Fatalf("unexpected model: %+v", m)
+	}
+
+	if im := m.Skins[0].Images[0]; im.ColorIndexAt(3, 1) != 7 || im.Bounds().Dx() != 4 {
+		t.Errorf("bad skin %v", im.Pix)
+	}
+
+	if !m.TexCoords[1].OnSeam || m.TexCoords[0].OnSeam || m.TexCoords[2].S != 3 {
+		t.Errorf("bad texcoords %+v", m.TexCoords)
+	}
+
+	if !m.Triangles[0].FacesFront || m.Triangles[0].Verts != [3]int{0, 1, 2} {
+		t.Errorf("bad triangle %+v", m.Triangles[0])
+	}
+
+	f := m.Frames[0].Frames[0]
+	if f.Name != "stand1" {
+		t.Errorf("frame name %q", f.Name)
+	}
+
+	if f.Verts[1].Pos != (Vector3{10, 0, 5}) || f.Verts[2].Pos != (Vector3{-10, 20, 25}) {
+		t.Errorf("bad vertices %+v", f.Verts)
+	}
+
+	if f.Verts[1].Normal != vertexanim.Normals[5] || f.Verts[2].NormalIndex != 161 {
+		t.Errorf("bad normals %+v", f.Verts)
+	}
+
+	if m.Frames[0].Max != (Vector3{10, 20, 25}) {
+		t.Errorf("bad bounds %v", m.Frames[0].Max)
+	}
+}
+
+func TestReadGroups(t *testing.T) {
+	m, err := Read(bytes.NewReader(buildMDL(true, true)), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s := m.Skins[0]; len(s.Images) != 2 || len(s.Times) != 2 {
+		t.Errorf("bad skin group %+v", s)
+	}
+
+	g := m.Frames[0]
+	if len(g.Frames) != 2 || g.Frames[1].Name != "run2" || g.Times[1] != float64(float32(0.2)) {
+		t.Errorf("bad frame group %+v", g)
+	}
+
+	if g.Min != (Vector3{-8, 2, 7}) {
+		t.Errorf("bad group bounds %v", g.Min)
+	}
+
+	if frames := m.AnimFrames(); len(frames) != 2 || frames[1].Name != "run2" || frames[1].Pos[2] != g.Frames[1].Verts[2].Pos {
+		t.Errorf("bad anim frames %+v", frames)
+	}
+
+	if m, err = Read(bytes.NewReader(buildMDL(true, false)), NoSkins); err != nil {
+		t.Fatal(err)
+	} else if len(m.Skins) != 1 || m.Skins[0].Images != nil {
+		t.Errorf("skins loaded with NoSkins")
+	}
+}
+
+func TestReadTruncated(t *testing.T) {
+	b := buildMDL(true, true)
+	for _, n := range []int{0, 10, 84, 100, len(b) - 1} {
+		if _, err := Read(bytes.NewReader(b[:n]), 0); err != ErrFormat {
+			t.Errorf("%d bytes: expected ErrFormat, got %v", n, err)
+		}
+	}
+}
+
+func TestReadOverflow(t *testing.T) {
+	for _, c := range []struct {
+		offset int
+		values []int32
+	}{
+		{52, []int32{24, 178956971}}, // skin size wrapping to 8 in int32
+		{52, []int32{-65536, -65536}},
+		{60, []int32{0x40000000}},
+		{60, []int32{-1}},
+	} {
+		b := buildMDL(false, false)
+		for i, v := range c.values {
+			binary.LittleEndian.PutUint32(b[c.offset+4*i:], uint32(v))
+		}
+
+		if _, err := Read(bytes.NewReader(b), 0); err != ErrFormat {
+			t.Errorf("%v at %d: expected ErrFormat, got %v", c.values, c.offset, err)
+		}
+	}
+}
@@ -0,0 +1,423 @@
+package q3shader
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Error is a syntax error in a shader script.
+type Error struct {
+	File string
+	Line int
+	Msg  string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("q3shader: %s:%d: %s", e.File, e.Line, e.Msg)
+}
+
+var blendShorthands = map[string][2]string{
+	"add":    {"GL_ONE", "GL_ONE"},
+	"filter": {"GL_DST_COLOR", "GL_ZERO"},
+	"blend":  {"GL_SRC_ALPHA", "GL_ONE_MINUS_SRC_ALPHA"},
+}
+
+var blendSrc = map[string]bool{
+	"GL_ONE":                 true,
+	"GL_ZERO":                true,
+	"GL_DST_COLOR":           true,
+	"GL_ONE_MINUS_DST_COLOR": true,
+	"GL_SRC_ALPHA":           true,
+	"GL_ONE_MINUS_SRC_ALPHA": true,
+	"GL_DST_ALPHA":           true,
+	"GL_ONE_MINUS_DST_ALPHA": true,
+	"GL_SRC_ALPHA_SATURATE":  true,
+}
+
+var blendDst = map[string]bool{
+	"GL_ONE":                 true,
+	"GL_ZERO":                true,
+	"GL_SRC_ALPHA":           true,
+	"GL_ONE_MINUS_SRC_ALPHA": true,
+	"GL_DST_ALPHA":           true,
+	"GL_ONE_MINUS_DST_ALPHA": true,
+	"GL_SRC_COLOR":           true,
+	"GL_ONE_MINUS_SRC_COLOR": true,
+}
+
+// stageArgs holds the number of required arguments of stage keywords.
+var stageArgs = map[string]int{
+	"map":       1,
+	"clampmap":  1,
+	"animmap":   2,
+	"videomap":  1,
+	"blendfunc": 1,
+	"rgbgen":    1,
+	"alphagen":  1,
+	"tcgen":     1,
+	"texgen":    1,
+	"tcmod":     1,
+	"alphafunc": 1,
+	"depthfunc": 1,
+}
+
+// maxAnimFrames is the engine limit of animMap frames.
+const maxAnimFrames = 8
+
+// Parse reads all shaders of a script. The file name is only used in error
+// messages and Shader.File.
+func Parse(r io.Reader, file string) (shaders []*Shader, err error) {
+	var b []byte
+	if b, err = ioutil.ReadAll(r); err != nil {
+		return
+	}
+
+	l := &lexer{b: b, line: 1, file: file}
+
+	for {
+		name, ok := l.token(false)
+		if !ok {
+			break
+		} else if name == "{" || name == "}" {
+			return nil, l.errorf("expected shader name, found %q", name)
+		}
+
+		s := &Shader{
+			Name: name,
+			File: file,
+			Line: l.line,
+			Cull: "front",
+		}
+
+		if tok, _ := l.token(false); tok != "{" {
+			return nil, l.errorf("expected '{' after shader name %q", name)
+		}
+
+		if err = l.shader(s); err != nil {
+			return nil, err
+		}
+
+		shaders = append(shaders, s)
+	}
+
+	return
+}
+
+// ParseFS reads all scripts/*.shader files and returns shaders by their
+// lower case names. As in the engine, the first definition of a shader
+// wins, with files read in name order.
+func ParseFS(fsys fs.FS) (shaders map[string]*Shader, err error) {
+	var names []string
+	if names, err = fs.Glob(fsys, "scripts/*.shader"); err != nil {
+		return
+	}
+	sort.Strings(names)
+
+	shaders = make(map[string]*Shader)
+	for _, name := range names {
+		var f fs.File
+		if f, err = fsys.Open(name); err != nil {
+			return
+		}
+
+		var ss []*Shader
+		ss, err = Parse(f, name)
+		f.Close()
+		if err != nil {
+			return
+		}
+
+		for _, s := range ss {
+			key := strings.ToLower(s.Name)
+			if _, ok := shaders[key]; !ok {
+				shaders[key] = s
+			}
+		}
+	}
+
+	return
+}
+
+// Lookup finds the shader for a texture name. An image extension in the
+// name is ignored, as the engine does.
+func Lookup(shaders map[string]*Shader, name string) *Shader {
+	name = strings.ToLower(name)
+	return shaders[strings.TrimSuffix(name, path.Ext(name))]
+}
+
+type lexer struct {
+	b    []byte
+	pos  int
+	line int
+	file string
+}
+
+func (l *lexer) errorf(format string, args ...interface{}) error {
+	return &Error{
+		File: l.file,
+		Line: l.line,
+		Msg:  fmt.Sprintf(format, args...),
+	}
+}
+
+// token returns the next token. With sameLine set, no tokens past the end
+// of the current line are returned.
+func (l *lexer) token(sameLine bool) (tok string, ok bool) {
+	for l.pos < len(l.b) {
+		c := l.b[l.pos]
+
+		if c == '\n' {
+			if sameLine {
+				return
+			}
+			l.line++
+			l.pos++
+		} else if c <= ' ' {
+			l.pos++
+		} else if c == '/' && l.pos+1 < len(l.b) && l.b[l.pos+1] == '/' {
+			for l.pos < len(l.b) && l.b[l.pos] != '\n' {
+				l.pos++
+			}
+		} else if c == '/' && l.pos+1 < len(l.b) && l.b[l.pos+1] == '*' {
+			l.pos += 2
+			for l.pos < len(l.b) && !(l.b[l.pos] == '*' && l.pos+1 < len(l.b) && l.b[l.pos+1] == '/') {
+				if l.b[l.pos] == '\n' {
+					l.line++
+				}
+				l.pos++
+			}
+			l.pos += 2
+		} else {
+			break
+		}
+	}
+
+	if l.pos >= len(l.b) {
+		return
+	}
+
+	start := l.pos
+	if l.b[l.pos] == '"' {
+		l.pos++
+		start++
+		for l.pos < len(l.b) && l.b[l.pos] != '"' && l.b[l.pos] != '\n' {
+			l.pos++
+		}
+		tok = string(l.b[start:l.pos])
+		if l.pos < len(l.b) && l.b[l.pos] == '"' {
+			l.pos++
+		}
+	} else {
+		for l.pos < len(l.b) && l.b[l.pos] > ' ' {
+			l.pos++
+		}
+		tok = string(l.b[start:l.pos])
+	}
+
+	return tok, true
+}
+
+// rest returns all tokens left on the current line.
+func (l *lexer) rest() (args []string) {
+	for {
+		tok, ok := l.token(true)
+		if !ok {
+			return
+		}
+		args = append(args, tok)
+	}
+}
+
+func (l *lexer) directive(name string) Directive {
+	line := l.line
+	return Directive{
+		Name: name,
+		Args: l.rest(),
+		Line: line,
+	}
+}
+
+func (l *lexer) shader(s *Shader) error {
+	for {
+		tok, ok := l.token(false)
+		if !ok {
+			return l.errorf("unexpected end of file in shader %q", s.Name)
+		} else if tok == "}" {
+			return nil
+		} else if tok == "{" {
+			st, err := l.stage(s)
+			if err != nil {
+				return err
+			}
+			s.Stages = append(s.Stages, st)
+			continue
+		}
+
+		d := l.directive(tok)
+		key := strings.ToLower(tok)
+
+		switch {
+		case key == "surfaceparm":
+			if len(d.Args) < 1 {
+				return l.missing(tok)
+			}
+			s.SurfaceParms = append(s.SurfaceParms, strings.ToLower(d.Args[0]))
+
+		case key == "cull":
+			if len(d.Args) < 1 {
+				return l.missing(tok)
+			}
+			switch strings.ToLower(d.Args[0]) {
+			case "none", "twosided", "disable":
+				s.Cull = "none"
+			case "back", "backside", "backsided":
+				s.Cull = "back"
+			case "front":
+				s.Cull = "front"
+			default:
+				return l.errorf("invalid cull parameter %q", d.Args[0])
+			}
+
+		case key == "skyparms":
+			if len(d.Args) < 3 {
+				return l.missing(tok)
+			}
+			sky := &SkyParms{
+				FarBox:  d.Args[0],
+				NearBox: d.Args[2],
+			}
+			if d.Args[1] != "-" {
+				h, err := strconv.ParseFloat(d.Args[1], 64)
+				if err != nil {
+					return l.errorf("invalid cloud height %q", d.Args[1])
+				}
+				sky.CloudHeight = h
+			}
+			s.Sky = sky
+
+		case key == "deformvertexes":
+			if len(d.Args) < 1 {
+				return l.missing(tok)
+			}
+			s.Deforms = append(s.Deforms, d)
+
+		case key == "sort":
+			if len(d.Args) < 1 {
+				return l.missing(tok)
+			}
+			s.Sort = d.Args[0]
+
+		case key == "nopicmip":
+			s.NoPicMip = true
+
+		case key == "nomipmaps":
+			s.NoMipMaps = true
+
+		case strings.HasPrefix(key, "q3map_"):
+			s.Q3Map = append(s.Q3Map, d)
+
+		case strings.HasPrefix(key, "qer_"):
+			s.Editor = append(s.Editor, d)
+
+		default:
+			s.Other = append(s.Other, d)
+		}
+	}
+}
+
+func (l *lexer) stage(s *Shader) (st *Stage, err error) {
+	st = &Stage{Line: l.line}
+
+	for {
+		tok, ok := l.token(false)
+		if !ok {
+			return nil, l.errorf("unexpected end of file in shader %q", s.Name)
+		} else if tok == "}" {
+			return
+		} else if tok == "{" {
+			return nil, l.errorf("unexpected '{' in a stage")
+		}
+
+		d := l.directive(tok)
+		key := strings.ToLower(tok)
+
+		if n, ok := stageArgs[key]; ok && len(d.Args) < n {
+			return nil, l.missing(tok)
+		}
+
+		switch key {
+		case "map", "clampmap":
+			st.Maps = []string{d.Args[0]}
+			st.Clamp = key == "clampmap"
+
+		case "animmap":
+			if st.AnimFreq, err = strconv.ParseFloat(d.Args[0], 64); err != nil {
+				return nil, l.errorf("invalid animMap frequency %q", d.Args[0])
+			}
+			st.Maps = d.Args[1:]
+			if len(st.Maps) > maxAnimFrames {
+				st.Maps = st.Maps[:maxAnimFrames]
+			}
+
+		case "videomap":
+			st.VideoMap = d.Args[0]
+
+		case "blendfunc":
+			if bf, ok := blendShorthands[strings.ToLower(d.Args[0])]; ok {
+				st.BlendSrc, st.BlendDst = bf[0], bf[1]
+			} else if len(d.Args) < 2 {
+				return nil, l.missing(tok)
+			} else {
+				st.BlendSrc = strings.ToUpper(d.Args[0])
+				st.BlendDst = strings.ToUpper(d.Args[1])
+				if !blendSrc[st.BlendSrc] {
+					return nil, l.errorf("unknown blend source %q", d.Args[0])
+				} else if !blendDst[st.BlendDst] {
+					return nil, l.errorf("unknown blend destination %q", d.Args[1])
+				}
+			}
+
+		case "rgbgen":
+			st.RGBGen = &d
+
+		case "alphagen":
+			st.AlphaGen = &d
+
+		case "tcgen", "texgen":
+			st.TCGen = &d
+
+		case "tcmod":
+			st.TCMods = append(st.TCMods, d)
+
+		case "alphafunc":
+			switch f := strings.ToUpper(d.Args[0]); f {
+			case "GT0", "LT128", "GE128":
+				st.AlphaFunc = f
+			default:
+				return nil, l.errorf("invalid alphaFunc %q", d.Args[0])
+			}
+
+		case "depthfunc":
+			st.DepthFunc = strings.ToLower(d.Args[0])
+
+		case "depthwrite":
+			st.DepthWrite = true
+
+		case "detail":
+			st.Detail = true
+
+		default:
+			st.Other = append(st.Other, d)
+		}
+	}
+}
+
+func (l *lexer) missing(keyword string) error {
+	return l.errorf("missing parameters for %q", keyword)
+}
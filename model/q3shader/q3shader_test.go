@@ -0,0 +1,131 @@
+package q3shader
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+const script = `// comment
+textures/skies/space
+{
+	qer_editorimage textures/skies/space_ed.tga
+	surfaceparm noimpact
+	surfaceparm nolightmap
+	surfaceparm sky
+	skyparms env/space1 512 -
+	q3map_sun 1 1 1 100 220 50
+}
+
+textures/liquids/water /* block
+comment */
+{
+	surfaceparm trans
+	cull disable
+	deformVertexes wave 64 sin .25 .25 0 .5
+	{
+		map textures/liquids/water.tga
+		blendFunc GL_dst_color GL_one
+		rgbGen identity
+		tcMod scale .5 .5
+		tcMod scroll .025 .01
+	}
+	{
+		animMap 10 textures/sfx/fire1.tga "textures/sfx/fire2.tga"
+		blendfunc add
+		alphaFunc GE128
+		depthWrite
+	}
+	{
+		map $lightmap
+	}
+}
+
+textures/common/nodraw
+{
+	surfaceparm nodraw
+}
+`
+
+func TestParse(t *testing.T) {
+	shaders, err := Parse(strings.NewReader(script), "test.shader")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(shaders) != 3 {
+		t.Fatalf("got %d shaders", len(shaders))
+	}
+
+	sky := shaders[0]
+	if sky.Name != "textures/skies/space" || sky.Line != 2 || !sky.IsSky() || sky.NoDraw() {
+		t.Errorf("unexpected %+v", sky)
+	} else if sky.Sky.FarBox != "env/space1" || sky.Sky.CloudHeight != 512 || sky.Sky.NearBox != "-" {
+		t.Errorf("unexpected sky %+v", sky.Sky)
+	} else if len(sky.Q3Map) != 1 || len(sky.Editor) != 1 || len(sky.Q3Map[0].Args) != 6 {
+		t.Errorf("unexpected q3map %+v, qer %+v", sky.Q3Map, sky.Editor)
+	}
+
+	water := shaders[1]
+	if water.Line != 12 || water.Cull != "none" || !water.Translucent() || len(water.Deforms) != 1 || len(water.Stages) != 3 {
+		t.Fatalf("unexpected %+v", water)
+	}
+
+	st := water.Stages[0]
+	if st.BlendSrc != "GL_DST_COLOR" || st.BlendDst != "GL_ONE" || len(st.TCMods) != 2 || st.RGBGen.Args[0] != "identity" {
+		t.Errorf("unexpected stage %+v", st)
+	}
+
+	st = water.Stages[1]
+	if st.AnimFreq != 10 || len(st.Maps) != 2 || st.Maps[1] != "textures/sfx/fire2.tga" || st.BlendSrc != "GL_ONE" || st.AlphaFunc != "GE128" || !st.DepthWrite {
+		t.Errorf("unexpected stage %+v", st)
+	}
+
+	if images := water.Images(); len(images) != 3 {
+		t.Errorf("images %v", images)
+	}
+
+	if !shaders[2].NoDraw() {
+		t.Error("nodraw")
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, c := range []struct {
+		script string
+		line   int
+	}{
+		{"foo\n{\n\t{\n\t\tblendFunc GL_ONE GL_FOO\n\t}\n}\n", 4},
+		{"foo\n{\n\tcull\n}\n", 3},
+		{"foo\n{\n\tsurfaceparm sky\n", 4},
+		{"foo\nbar\n", 2},
+		{"{\n}\n", 1},
+	} {
+		_, err := Parse(strings.NewReader(c.script), "bad.shader")
+		if e, ok := err.(*Error); !ok {
+			t.Errorf("%q: got %v", c.script, err)
+		} else if e.File != "bad.shader" || e.Line != c.line {
+			t.Errorf("%q: got %v, want line %d", c.script, e, c.line)
+		}
+	}
+}
+
+func TestParseFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"scripts/a.shader": {Data: []byte("textures/base/wall\n{\n\tsurfaceparm metalsteps\n}\n")},
+		"scripts/b.shader": {Data: []byte("textures/base/wall\n{\n}\ntextures/base/floor\n{\n}\n")},
+	}
+
+	shaders, err := ParseFS(fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s := Lookup(shaders, "textures/base/WALL"); s == nil || s.File != "scripts/a.shader" {
+		t.Errorf("unexpected %+v", s)
+	}
+
+	if s := Lookup(shaders, "textures/base/floor.tga"); s == nil || s.File != "scripts/b.shader" {
+		t.Errorf("unexpected %+v", s)
+	}
+}
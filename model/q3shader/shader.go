@@ -0,0 +1,133 @@
+/*
+Package q3shader provides support for reading Quake3 shader scripts.
+
+Texture names in Quake3 maps usually refer to shaders defined in
+scripts/*.shader rather than to image files. A shader holds global keywords
+(surface parameters, culling, sky and vertex deformation) followed by
+stages, each of them drawing one image with its own blending and texture
+coordinate modifiers.
+*/
+package q3shader
+
+import (
+	"strings"
+)
+
+// Directive is a keyword with its arguments as found in a script.
+type Directive struct {
+	Name string
+	Args []string
+	Line int
+}
+
+// SkyParms describes a sky set with the skyparms keyword. Empty boxes are
+// given as "-" in scripts.
+type SkyParms struct {
+	FarBox      string
+	CloudHeight float64
+	NearBox     string
+}
+
+// Shader is a shader definition from a script. Keywords the package does
+// not interpret are kept as directives.
+type Shader struct {
+	Name         string // as written in the script, ParseFS keys it in lower case
+	File         string // script the shader was defined in
+	Line         int    // line of the name in File
+	SurfaceParms []string
+	Cull         string // "front" (the default), "back" or "none"
+	Sky          *SkyParms
+	Deforms      []Directive // deformVertexes
+	Sort         string      // a name such as "opaque" or a number, empty if not set
+	NoPicMip     bool
+	NoMipMaps    bool
+	Q3Map        []Directive // q3map_* keywords, used by the map compiler
+	Editor       []Directive // qer_* keywords, used by the map editor
+	Other        []Directive // any other keywords
+	Stages       []*Stage    // in drawing order
+}
+
+// Stage is a single pass of a shader, drawing one (possibly animated)
+// image.
+type Stage struct {
+	Line       int      // line of the opening brace
+	Maps       []string // one image for map/clampMap, frames for animMap
+	Clamp      bool     // clampMap, texture coordinates do not repeat
+	AnimFreq   float64  // animMap frames per second
+	VideoMap   string   // cinematic played on the stage
+	BlendSrc   string   // e.g. "GL_ONE", empty if not blended
+	BlendDst   string
+	RGBGen     *Directive
+	AlphaGen   *Directive
+	TCGen      *Directive  // tcGen or texGen
+	TCMods     []Directive // applied in order
+	AlphaFunc  string      // "GT0", "LT128" or "GE128"
+	DepthFunc  string      // "equal" or "lequal", lower case
+	DepthWrite bool
+	Detail     bool        // dropped with r_detailTextures off
+	Other      []Directive // any other keywords
+}
+
+// Special image names.
+const (
+	Lightmap   = "$lightmap"
+	WhiteImage = "$whiteimage"
+)
+
+// HasSurfaceParm reports whether the shader has the given surfaceparm.
+func (s *Shader) HasSurfaceParm(p string) bool {
+	for _, sp := range s.SurfaceParms {
+		if strings.EqualFold(sp, p) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// IsSky reports whether surfaces with the shader show the sky.
+func (s *Shader) IsSky() bool {
+	return s.Sky != nil || s.HasSurfaceParm("sky")
+}
+
+// NoDraw reports whether surfaces with the shader are not drawn at all.
+func (s *Shader) NoDraw() bool {
+	return s.HasSurfaceParm("nodraw")
+}
+
+// Translucent reports whether surfaces with the shader let others be seen
+// through them.
+func (s *Shader) Translucent() bool {
+	if s.HasSurfaceParm("trans") {
+		return true
+	}
+
+	if len(s.Stages) > 0 {
+		st := s.Stages[0]
+		return st.AlphaFunc != "" || st.Blended()
+	}
+
+	return false
+}
+
+// Images returns names of all images used by the shader stages, skipping
+// the special ones. Each image is listed once.
+func (s *Shader) Images() (images []string) {
+	seen := make(map[string]bool)
+
+	for _, st := range s.Stages {
+		for _, m := range st.Maps {
+			if !strings.HasPrefix(m, "$") && !seen[m] {
+				seen[m] = true
+				images = append(images, m)
+			}
+		}
+	}
+
+	return
+}
+
+// Blended reports whether the stage is blended with what's behind it.
+func (st *Stage) Blended() bool {
+	return st.BlendSrc != "" && !(st.BlendSrc == "GL_ONE" && st.BlendDst == "GL_ZERO")
+}
@@ -0,0 +1,98 @@
+package studio
+
+import (
+	"encoding/binary"
+)
+
+// readAnimations decodes animations of sequences in the given group from
+// b, which is the model itself for group 0 or a sequence group file.
+func (m *Model) readAnimations(b []byte, group int) (err error) {
+	for i := range m.Sequences {
+		seq := &m.Sequences[i]
+		if seq.SequenceGroup != group {
+			continue
+		}
+
+		blendSize := int64(len(m.Bones)) * 12
+		if int64(seq.animOffset)+int64(seq.NumBlends)*blendSize > int64(len(b)) {
+			return ErrFormat
+		}
+
+		seq.Blends = make([][]BoneAnim, seq.NumBlends)
+		for j := range seq.Blends {
+			offset := int64(seq.animOffset) + int64(j)*blendSize
+			if seq.Blends[j], err = m.readBlend(b, offset, seq.NumFrames); err != nil {
+				seq.Blends = nil
+				return
+			}
+		}
+	}
+
+	return
+}
+
+func (m *Model) readBlend(b []byte, offset int64, numFrames int) (anims []BoneAnim, err error) {
+	if offset < 0 || offset+int64(len(m.Bones)*12) > int64(len(b)) {
+		return nil, ErrFormat
+	}
+
+	anims = make([]BoneAnim, len(m.Bones))
+	for i := range anims {
+		bone := &m.Bones[i]
+		base := offset + int64(i*12)
+
+		for j := 0; j < 6; j++ {
+			animOffset := binary.LittleEndian.Uint16(b[base+int64(j*2):])
+			if animOffset == 0 {
+				continue
+			}
+
+			if anims[i][j], err = readChannel(b, base+int64(animOffset), numFrames); err != nil {
+				return
+			}
+
+			for k, v := range anims[i][j] {
+				anims[i][j][k] = bone.Value[j] + v*bone.Scale[j]
+			}
+		}
+	}
+
+	return
+}
+
+// readChannel decodes run-length encoded values of a channel for each
+// frame. Each run starts with a pair of bytes: the number of values stored
+// and the number of frames covered, the last value repeating, so a run of
+// at least four bytes covers no more than 255 frames.
+func readChannel(b []byte, offset int64, numFrames int) (values []float64, err error) {
+	if offset < 0 || offset > int64(len(b)) || int64(numFrames) > (int64(len(b))-offset)/4*255 {
+		return nil, ErrFormat
+	}
+
+	values = make([]float64, 0, numFrames)
+
+	for len(values) < numFrames {
+		if offset+2 > int64(len(b)) {
+			return nil, ErrFormat
+		}
+
+		valid, total := int(b[offset]), int(b[offset+1])
+		if valid == 0 || total == 0 || offset+int64(2+valid*2) > int64(len(b)) {
+			return nil, ErrFormat
+		}
+
+		for k := 0; k < total && len(values) < numFrames; k++ {
+			n := k
+			if n >= valid {
+				n = valid - 1
+			}
+
+			v := int16(binary.LittleEndian.Uint16(b[offset+int64(2+n*2):]))
+			values = append(values, float64(v))
+		}
+
+		offset += int64(2 + valid*2)
+	}
+
+	return
+}
@@ -0,0 +1,237 @@
+package studio
+
+import (
+	"fmt"
+	"math"
+)
+
+// Matrix is a 3x4 bone transformation matrix, the last column being the
+// translation.
+type Matrix [3][4]float64
+
+// Transform transforms a point.
+func (m *Matrix) Transform(v Vector3) (out Vector3) {
+	for i := range out {
+		out[i] = m[i][0]*v[0] + m[i][1]*v[1] + m[i][2]*v[2] + m[i][3]
+	}
+
+	return
+}
+
+// Rotate transforms a direction, ignoring the translation.
+func (m *Matrix) Rotate(v Vector3) (out Vector3) {
+	for i := range out {
+		out[i] = m[i][0]*v[0] + m[i][1]*v[1] + m[i][2]*v[2]
+	}
+
+	return
+}
+
+func (m *Matrix) concat(in *Matrix) (out Matrix) {
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 4; j++ {
+			out[i][j] = m[i][0]*in[0][j] + m[i][1]*in[1][j] + m[i][2]*in[2][j]
+		}
+		out[i][3] += m[i][3]
+	}
+
+	return
+}
+
+type quaternion [4]float64 // x, y, z, w
+
+func angleQuaternion(a Vector3) (q quaternion) {
+	sy, cy := math.Sincos(a[2] * 0.5)
+	sp, cp := math.Sincos(a[1] * 0.5)
+	sr, cr := math.Sincos(a[0] * 0.5)
+
+	q[0] = sr*cp*cy - cr*sp*sy
+	q[1] = cr*sp*cy + sr*cp*sy
+	q[2] = cr*cp*sy - sr*sp*cy
+	q[3] = cr*cp*cy + sr*sp*sy
+
+	return
+}
+
+func quaternionSlerp(p, q quaternion, t float64) (out quaternion) {
+	// decide if one of the quaternions is backwards
+	var a, b float64
+	for i := range p {
+		a += (p[i] - q[i]) * (p[i] - q[i])
+		b += (p[i] + q[i]) * (p[i] + q[i])
+	}
+	if a > b {
+		for i := range q {
+			q[i] = -q[i]
+		}
+	}
+
+	cosom := p[0]*q[0] + p[1]*q[1] + p[2]*q[2] + p[3]*q[3]
+	sclp, sclq := 1-t, t
+
+	if 1+cosom > 1e-6 {
+		if 1-cosom > 1e-6 {
+			omega := math.Acos(cosom)
+			sinom := math.Sin(omega)
+			sclp = math.Sin((1-t)*omega) / sinom
+			sclq = math.Sin(t*omega) / sinom
+		}
+
+		for i := range out {
+			out[i] = sclp*p[i] + sclq*q[i]
+		}
+	} else {
+		out = quaternion{-q[1], q[0], -q[3], q[2]}
+		sclp = math.Sin((1 - t) * 0.5 * math.Pi)
+		sclq = math.Sin(t * 0.5 * math.Pi)
+		for i := 0; i < 3; i++ {
+			out[i] = sclp*p[i] + sclq*out[i]
+		}
+	}
+
+	return
+}
+
+func (q quaternion) matrix(pos Vector3) (m Matrix) {
+	x, y, z, w := q[0], q[1], q[2], q[3]
+
+	m[0][0] = 1 - 2*y*y - 2*z*z
+	m[1][0] = 2*x*y + 2*w*z
+	m[2][0] = 2*x*z - 2*w*y
+
+	m[0][1] = 2*x*y - 2*w*z
+	m[1][1] = 1 - 2*x*x - 2*z*z
+	m[2][1] = 2*y*z + 2*w*x
+
+	m[0][2] = 2*x*z + 2*w*y
+	m[1][2] = 2*y*z - 2*w*x
+	m[2][2] = 1 - 2*x*x - 2*y*y
+
+	m[0][3] = pos[0]
+	m[1][3] = pos[1]
+	m[2][3] = pos[2]
+
+	return
+}
+
+// controllerAdjust returns adjustments applied by bone controllers, given
+// controller values (0-1) indexed by BoneController.Index. Missing values
+// are taken as 0.
+func (m *Model) controllerAdjust(values []float64) []float64 {
+	adj := make([]float64, len(m.BoneControllers))
+
+	for i, c := range m.BoneControllers {
+		var v float64
+		if c.Index >= 0 && c.Index < len(values) {
+			v = values[c.Index]
+		}
+
+		if c.Type&ControlRLoop != 0 {
+			v = v*360 + c.Start
+		} else {
+			v = math.Max(0, math.Min(1, v))
+			v = (1-v)*c.Start + v*c.End
+		}
+
+		if c.Type&(ControlXR|ControlYR|ControlZR) != 0 {
+			v *= math.Pi / 180
+		}
+
+		adj[i] = v
+	}
+
+	return adj
+}
+
+// Pose evaluates the first blend of sequence seq at the given frame
+// (fractional frames are interpolated) and returns a transformation matrix
+// for each bone. Controllers are bone controller values, see
+// controllerAdjust.
+func (m *Model) Pose(seq int, frame float64, controllers []float64) (bones []Matrix, err error) {
+	if seq < 0 || seq >= len(m.Sequences) {
+		return nil, fmt.Errorf("studio: no sequence %d", seq)
+	}
+
+	s := &m.Sequences[seq]
+	if s.Blends == nil {
+		return nil, fmt.Errorf("studio: sequence group %d not loaded", s.SequenceGroup)
+	}
+
+	n := float64(s.NumFrames)
+	if s.Flags&SequenceLooping != 0 {
+		frame = math.Mod(frame, n)
+		if frame < 0 {
+			frame += n
+		}
+	} else {
+		frame = math.Max(0, math.Min(n-1, frame))
+	}
+
+	f1 := int(frame)
+	f2 := f1 + 1
+	if f2 >= s.NumFrames {
+		if s.Flags&SequenceLooping != 0 {
+			f2 = 0
+		} else {
+			f2 = s.NumFrames - 1
+		}
+	}
+	t := frame - float64(f1)
+
+	adj := m.controllerAdjust(controllers)
+	anims := s.Blends[0]
+	bones = make([]Matrix, len(m.Bones))
+
+	for i := range m.Bones {
+		bone := &m.Bones[i]
+
+		var pos, angle1, angle2 Vector3
+		for j := 0; j < 3; j++ {
+			pos[j] = lerp(bone, anims[i][j], j, f1, f2, t)
+			angle1[j], angle2[j] = channel(bone, anims[i][j+3], j+3, f1), channel(bone, anims[i][j+3], j+3, f2)
+
+			if c := bone.Controllers[j]; c >= 0 {
+				pos[j] += adj[c]
+			}
+			if c := bone.Controllers[j+3]; c >= 0 {
+				angle1[j] += adj[c]
+				angle2[j] += adj[c]
+			}
+		}
+
+		// linear movement is left to the game
+		if i == s.MotionBone {
+			for j := 0; j < 3; j++ {
+				if s.MotionType&(MotionX<<uint(j)) != 0 {
+					pos[j] = 0
+				}
+			}
+		}
+
+		q := angleQuaternion(angle1)
+		if angle1 != angle2 {
+			q = quaternionSlerp(q, angleQuaternion(angle2), t)
+		}
+
+		local := q.matrix(pos)
+		if bone.Parent < 0 {
+			bones[i] = local
+		} else {
+			bones[i] = bones[bone.Parent].concat(&local)
+		}
+	}
+
+	return
+}
+
+func channel(bone *Bone, values []float64, j, frame int) float64 {
+	if values == nil {
+		return bone.Value[j]
+	}
+
+	return values[frame]
+}
+
+func lerp(bone *Bone, values []float64, j, f1, f2 int, t float64) float64 {
+	return channel(bone, values, j, f1)*(1-t) + channel(bone, values, j, f2)*t
+}
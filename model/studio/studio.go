@@ -0,0 +1,984 @@
+/*
+Package studio provides support for reading Half-Life studio models
+(models/*.mdl).
+*/
+package studio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"strings"
+)
+
+type Vector3 [3]float64
+
+// BoneController types.
+const (
+	ControlX = 1 << iota
+	ControlY
+	ControlZ
+	ControlXR
+	ControlYR
+	ControlZR
+	ControlRLoop = 0x8000
+)
+
+// Sequence motion types use the same bits as bone controller types.
+const (
+	MotionX = ControlX
+	MotionY = ControlY
+	MotionZ = ControlZ
+)
+
+const (
+	SequenceLooping = 1
+)
+
+type TextureFlags uint32
+
+const (
+	TextureFlatShade = TextureFlags(1 << iota)
+	TextureChrome
+	TextureFullBright
+	TextureNoMips
+	TextureAlpha
+	TextureAdditive
+	TextureMasked // palette index 255 is transparent
+)
+
+type Bone struct {
+	Name        string
+	Parent      int    // -1 for root bones
+	Flags       uint32 // unused by the engine
+	Controllers [6]int // bone controller per channel, -1 if none
+	Value       [6]float64
+	Scale       [6]float64
+}
+
+type BoneController struct {
+	Bone       int
+	Type       int
+	Start, End float64
+	Rest       int
+	Index      int // 0-3 are user controllers, 4 is the mouth
+}
+
+type HitBox struct {
+	Bone  int
+	Group int
+	Min   Vector3
+	Max   Vector3
+}
+
+// SequenceGroup is a file holding animations of sequences. Group 0 is the
+// model itself, others are usually named like "models/scientist01.mdl".
+type SequenceGroup struct {
+	Label string
+	Name  string
+}
+
+type Event struct {
+	Frame   int
+	Event   int
+	Type    int
+	Options string
+}
+
+// BoneAnim holds decoded values of the six channels of a bone (position X,
+// Y, Z and rotation X, Y, Z in radians) for each frame of a sequence. A
+// channel is nil when it is constant and equal to Bone.Value.
+type BoneAnim [6][]float64
+
+type Sequence struct {
+	Label          string
+	FPS            float64
+	Flags          uint32
+	Activity       int
+	ActWeight      int
+	Events         []Event
+	NumFrames      int
+	MotionType     int
+	MotionBone     int
+	LinearMovement Vector3
+	Min            Vector3
+	Max            Vector3
+	NumBlends      int
+	BlendType      [2]int
+	BlendStart     [2]float64
+	BlendEnd       [2]float64
+	SequenceGroup  int
+	EntryNode      int
+	ExitNode       int
+	NodeFlags      int
+	NextSequence   int
+
+	// Blends holds animations per blend and bone. It is nil until the
+	// sequence group is read.
+	Blends [][]BoneAnim
+
+	animOffset int32
+}
+
+type Texture struct {
+	Name   string
+	Flags  TextureFlags
+	Width  int
+	Height int
+	Image  *image.Paletted // nil with NoTextures
+}
+
+type TriVertex struct {
+	Vert   int // index into SubModel.Verts
+	Normal int // index into SubModel.Normals
+	S, T   int // in texture pixels
+}
+
+// TriCommand is a triangle strip or a triangle fan.
+type TriCommand struct {
+	Fan   bool
+	Verts []TriVertex
+}
+
+type Mesh struct {
+	SkinRef  int
+	NumTris  int
+	Commands []TriCommand
+}
+
+type SubModel struct {
+	Name           string
+	Type           int
+	BoundingRadius float64
+	Meshes         []Mesh
+	Verts          []Vector3
+	VertBones      []int
+	Normals        []Vector3
+	NormalBones    []int
+}
+
+type BodyPart struct {
+	Name   string
+	Base   int
+	Models []SubModel
+}
+
+type Attachment struct {
+	Name    string
+	Type    int
+	Bone    int
+	Origin  Vector3
+	Vectors [3]Vector3
+}
+
+type Model struct {
+	Name            string
+	EyePosition     Vector3
+	Min             Vector3
+	Max             Vector3
+	BBMin           Vector3
+	BBMax           Vector3
+	Flags           uint32
+	Bones           []Bone
+	BoneControllers []BoneController
+	HitBoxes        []HitBox
+	Sequences       []Sequence
+	SequenceGroups  []SequenceGroup
+	Textures        []Texture
+	SkinFamilies    [][]int // texture index per skin reference
+	BodyParts       []BodyPart
+	Attachments     []Attachment
+}
+
+const (
+	NoTextures   = 1 << iota // do not decode texture pixels
+	NoAnimations             // do not decode sequence animations
+)
+
+var (
+	ErrFormat = errors.New("studio: invalid studio model format")
+)
+
+type studioHeader struct {
+	Id                  [4]byte
+	Version             int32
+	Name                [64]byte
+	Length              int32
+	EyePosition         [3]float32
+	Min                 [3]float32
+	Max                 [3]float32
+	BBMin               [3]float32
+	BBMax               [3]float32
+	Flags               uint32
+	NumBones            int32
+	BoneIndex           int32
+	NumBoneControllers  int32
+	BoneControllerIndex int32
+	NumHitBoxes         int32
+	HitBoxIndex         int32
+	NumSeq              int32
+	SeqIndex            int32
+	NumSeqGroups        int32
+	SeqGroupIndex       int32
+	NumTextures         int32
+	TextureIndex        int32
+	TextureDataIndex    int32
+	NumSkinRef          int32
+	NumSkinFamilies     int32
+	SkinIndex           int32
+	NumBodyParts        int32
+	BodyPartIndex       int32
+	NumAttachments      int32
+	AttachmentIndex     int32
+	SoundTable          int32
+	SoundIndex          int32
+	SoundGroups         int32
+	SoundGroupIndex     int32
+	NumTransitions      int32
+	TransitionIndex     int32
+}
+
+type studioBone struct {
+	Name        [32]byte
+	Parent      int32
+	Flags       uint32
+	Controllers [6]int32
+	Value       [6]float32
+	Scale       [6]float32
+}
+
+type studioBoneController struct {
+	Bone       int32
+	Type       int32
+	Start, End float32
+	Rest       int32
+	Index      int32
+}
+
+type studioHitBox struct {
+	Bone  int32
+	Group int32
+	Min   [3]float32
+	Max   [3]float32
+}
+
+type studioSeqGroup struct {
+	Label  [32]byte
+	Name   [64]byte
+	Unused [2]int32
+}
+
+type studioSeqDesc struct {
+	Label              [32]byte
+	FPS                float32
+	Flags              uint32
+	Activity           int32
+	ActWeight          int32
+	NumEvents          int32
+	EventIndex         int32
+	NumFrames          int32
+	NumPivots          int32
+	PivotIndex         int32
+	MotionType         int32
+	MotionBone         int32
+	LinearMovement     [3]float32
+	AutoMovePosIndex   int32
+	AutoMoveAngleIndex int32
+	BBMin              [3]float32
+	BBMax              [3]float32
+	NumBlends          int32
+	AnimIndex          int32
+	BlendType          [2]int32
+	BlendStart         [2]float32
+	BlendEnd           [2]float32
+	BlendParent        int32
+	SeqGroup           int32
+	EntryNode          int32
+	ExitNode           int32
+	NodeFlags          int32
+	NextSeq            int32
+}
+
+type studioEvent struct {
+	Frame   int32
+	Event   int32
+	Type    int32
+	Options [64]byte
+}
+
+type studioTexture struct {
+	Name   [64]byte
+	Flags  uint32
+	Width  int32
+	Height int32
+	Index  int32
+}
+
+type studioBodyPart struct {
+	Name       [64]byte
+	NumModels  int32
+	Base       int32
+	ModelIndex int32
+}
+
+type studioModel struct {
+	Name           [64]byte
+	Type           int32
+	BoundingRadius float32
+	NumMesh        int32
+	MeshIndex      int32
+	NumVerts       int32
+	VertInfoIndex  int32
+	VertIndex      int32
+	NumNorms       int32
+	NormInfoIndex  int32
+	NormIndex      int32
+	NumGroups      int32
+	GroupIndex     int32
+}
+
+type studioMesh struct {
+	NumTris   int32
+	TriIndex  int32
+	SkinRef   int32
+	NumNorms  int32
+	NormIndex int32
+}
+
+type studioAttachment struct {
+	Name    [32]byte
+	Type    int32
+	Bone    int32
+	Origin  [3]float32
+	Vectors [3][3]float32
+}
+
+const seqHeaderLen = 76 // "IDSQ" sequence group file header
+
+// section returns a reader of n items of the given size at offset. Counts
+// are int64 so products of header values can not wrap around.
+func section(b []byte, offset int32, n int64, size int32) (*bytes.Reader, error) {
+	if offset < 0 || n < 0 || n > int64(len(b)) || int64(offset)+n*int64(size) > int64(len(b)) {
+		return nil, ErrFormat
+	}
+
+	return bytes.NewReader(b[offset:]), nil
+}
+
+// readItems reads n items of the given size at offset into data, which
+// must be a slice of n items.
+func readItems(b []byte, offset int32, n int64, size int32, data interface{}) error {
+	r, err := section(b, offset, n, size)
+	if err != nil {
+		return err
+	}
+
+	return read(r, data)
+}
+
+func read(r io.Reader, data interface{}) error {
+	if err := binary.Read(r, binary.LittleEndian, data); err != nil {
+		return ErrFormat
+	}
+
+	return nil
+}
+
+func readHeader(b []byte) (h *studioHeader, err error) {
+	h = new(studioHeader)
+	if err = read(bytes.NewReader(b), h); err != nil {
+		return
+	} else if h.Id != [4]byte{'I', 'D', 'S', 'T'} || h.Version != 10 {
+		err = ErrFormat
+	}
+
+	return
+}
+
+// Read reads a model. Textures stored in a separate "*t.mdl" file and
+// animations of sequence groups other than 0 are read with ReadTextures and
+// ReadSequenceGroup, or all at once with Open.
+func Read(r io.Reader, flags int) (m *Model, err error) {
+	var b []byte
+	if b, err = ioutil.ReadAll(r); err != nil {
+		return
+	}
+
+	var h *studioHeader
+	if h, err = readHeader(b); err != nil {
+		return
+	}
+
+	m = &Model{
+		Name:        cString(h.Name[:]),
+		EyePosition: vector3(h.EyePosition),
+		Min:         vector3(h.Min),
+		Max:         vector3(h.Max),
+		BBMin:       vector3(h.BBMin),
+		BBMax:       vector3(h.BBMax),
+		Flags:       h.Flags,
+	}
+
+	if err = m.readBones(b, h); err != nil {
+		return nil, err
+	} else if err = m.readHitBoxes(b, h); err != nil {
+		return nil, err
+	} else if err = m.readSequences(b, h); err != nil {
+		return nil, err
+	} else if err = m.readBodyParts(b, h); err != nil {
+		return nil, err
+	} else if err = m.readAttachments(b, h); err != nil {
+		return nil, err
+	} else if err = m.readTextures(b, h, flags); err != nil {
+		return nil, err
+	}
+
+	if flags&NoAnimations == 0 {
+		err = m.readAnimations(b, 0)
+	}
+
+	return
+}
+
+// ReadTextures reads textures and skin families from a "*t.mdl" file of a
+// model that has none.
+func (m *Model) ReadTextures(r io.Reader, flags int) (err error) {
+	var b []byte
+	if b, err = ioutil.ReadAll(r); err != nil {
+		return
+	}
+
+	var h *studioHeader
+	if h, err = readHeader(b); err != nil {
+		return
+	}
+
+	return m.readTextures(b, h, flags)
+}
+
+// ReadSequenceGroup reads animations of sequences in group i from a
+// sequence group file.
+func (m *Model) ReadSequenceGroup(i int, r io.Reader) (err error) {
+	if i <= 0 || i >= len(m.SequenceGroups) {
+		return fmt.Errorf("studio: no sequence group %d", i)
+	}
+
+	var b []byte
+	if b, err = ioutil.ReadAll(r); err != nil {
+		return
+	} else if len(b) < seqHeaderLen || !bytes.Equal(b[:4], []byte("IDSQ")) {
+		return ErrFormat
+	}
+
+	return m.readAnimations(b, i)
+}
+
+// Open reads a model from fsys, along with its texture file and sequence
+// groups if it has any.
+func Open(fsys fs.FS, name string, flags int) (m *Model, err error) {
+	var f fs.File
+	if f, err = fsys.Open(name); err != nil {
+		return
+	}
+
+	m, err = Read(f, flags)
+	f.Close()
+	if err != nil {
+		return
+	}
+
+	base := strings.TrimSuffix(name, ".mdl")
+
+	if len(m.Textures) == 0 {
+		if f, err = fsys.Open(base + "t.mdl"); err != nil {
+			return nil, err
+		}
+
+		err = m.ReadTextures(f, flags)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if flags&NoAnimations != 0 {
+		return
+	}
+
+	for i := 1; i < len(m.SequenceGroups); i++ {
+		if f, err = fsys.Open(fmt.Sprintf("%s%02d.mdl", base, i)); err != nil {
+			return nil, err
+		}
+
+		err = m.ReadSequenceGroup(i, f)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return
+}
+
+func (m *Model) readBones(b []byte, h *studioHeader) (err error) {
+	var r *bytes.Reader
+	if r, err = section(b, h.BoneIndex, int64(h.NumBones), 112); err != nil {
+		return
+	}
+
+	bones := make([]studioBone, h.NumBones)
+	if err = read(r, bones); err != nil {
+		return
+	}
+
+	m.Bones = make([]Bone, len(bones))
+	for i, sb := range bones {
+		if sb.Parent < -1 || sb.Parent >= int32(i) {
+			return ErrFormat
+		}
+
+		bone := Bone{
+			Name:   cString(sb.Name[:]),
+			Parent: int(sb.Parent),
+			Flags:  sb.Flags,
+		}
+
+		for j := 0; j < 6; j++ {
+			if sb.Controllers[j] < -1 || sb.Controllers[j] >= h.NumBoneControllers {
+				return ErrFormat
+			}
+
+			bone.Controllers[j] = int(sb.Controllers[j])
+			bone.Value[j] = float64(sb.Value[j])
+			bone.Scale[j] = float64(sb.Scale[j])
+		}
+
+		m.Bones[i] = bone
+	}
+
+	if r, err = section(b, h.BoneControllerIndex, int64(h.NumBoneControllers), 24); err != nil {
+		return
+	}
+
+	controllers := make([]studioBoneController, h.NumBoneControllers)
+	if err = read(r, controllers); err != nil {
+		return
+	}
+
+	m.BoneControllers = make([]BoneController, len(controllers))
+	for i, c := range controllers {
+		m.BoneControllers[i] = BoneController{
+			Bone:  int(c.Bone),
+			Type:  int(c.Type),
+			Start: float64(c.Start),
+			End:   float64(c.End),
+			Rest:  int(c.Rest),
+			Index: int(c.Index),
+		}
+	}
+
+	return
+}
+
+func (m *Model) readHitBoxes(b []byte, h *studioHeader) (err error) {
+	var r *bytes.Reader
+	if r, err = section(b, h.HitBoxIndex, int64(h.NumHitBoxes), 32); err != nil {
+		return
+	}
+
+	boxes := make([]studioHitBox, h.NumHitBoxes)
+	if err = read(r, boxes); err != nil {
+		return
+	}
+
+	m.HitBoxes = make([]HitBox, len(boxes))
+	for i, box := range boxes {
+		m.HitBoxes[i] = HitBox{
+			Bone:  int(box.Bone),
+			Group: int(box.Group),
+			Min:   vector3(box.Min),
+			Max:   vector3(box.Max),
+		}
+	}
+
+	return
+}
+
+func (m *Model) readSequences(b []byte, h *studioHeader) (err error) {
+	var r *bytes.Reader
+	if r, err = section(b, h.SeqGroupIndex, int64(h.NumSeqGroups), 104); err != nil {
+		return
+	}
+
+	groups := make([]studioSeqGroup, h.NumSeqGroups)
+	if err = read(r, groups); err != nil {
+		return
+	}
+
+	m.SequenceGroups = make([]SequenceGroup, len(groups))
+	for i, g := range groups {
+		m.SequenceGroups[i] = SequenceGroup{
+			Label: cString(g.Label[:]),
+			Name:  cString(g.Name[:]),
+		}
+	}
+
+	if r, err = section(b, h.SeqIndex, int64(h.NumSeq), 176); err != nil {
+		return
+	}
+
+	seqs := make([]studioSeqDesc, h.NumSeq)
+	if err = read(r, seqs); err != nil {
+		return
+	}
+
+	m.Sequences = make([]Sequence, len(seqs))
+	for i, sd := range seqs {
+		if sd.SeqGroup < 0 || sd.SeqGroup >= h.NumSeqGroups || sd.NumFrames < 1 || sd.NumBlends < 1 {
+			return ErrFormat
+		} else if sd.MotionBone < 0 || sd.MotionBone >= h.NumBones {
+			return ErrFormat
+		}
+
+		seq := Sequence{
+			Label:          cString(sd.Label[:]),
+			FPS:            float64(sd.FPS),
+			Flags:          sd.Flags,
+			Activity:       int(sd.Activity),
+			ActWeight:      int(sd.ActWeight),
+			NumFrames:      int(sd.NumFrames),
+			MotionType:     int(sd.MotionType),
+			MotionBone:     int(sd.MotionBone),
+			LinearMovement: vector3(sd.LinearMovement),
+			Min:            vector3(sd.BBMin),
+			Max:            vector3(sd.BBMax),
+			NumBlends:      int(sd.NumBlends),
+			SequenceGroup:  int(sd.SeqGroup),
+			EntryNode:      int(sd.EntryNode),
+			ExitNode:       int(sd.ExitNode),
+			NodeFlags:      int(sd.NodeFlags),
+			NextSequence:   int(sd.NextSeq),
+			animOffset:     sd.AnimIndex,
+		}
+
+		for j := 0; j < 2; j++ {
+			seq.BlendType[j] = int(sd.BlendType[j])
+			seq.BlendStart[j] = float64(sd.BlendStart[j])
+			seq.BlendEnd[j] = float64(sd.BlendEnd[j])
+		}
+
+		if r, err = section(b, sd.EventIndex, int64(sd.NumEvents), 76); err != nil {
+			return
+		}
+
+		events := make([]studioEvent, sd.NumEvents)
+		if err = read(r, events); err != nil {
+			return
+		}
+
+		seq.Events = make([]Event, len(events))
+		for j, e := range events {
+			seq.Events[j] = Event{
+				Frame:   int(e.Frame),
+				Event:   int(e.Event),
+				Type:    int(e.Type),
+				Options: cString(e.Options[:]),
+			}
+		}
+
+		m.Sequences[i] = seq
+	}
+
+	return
+}
+
+func (m *Model) readBodyParts(b []byte, h *studioHeader) (err error) {
+	var r *bytes.Reader
+	if r, err = section(b, h.BodyPartIndex, int64(h.NumBodyParts), 76); err != nil {
+		return
+	}
+
+	parts := make([]studioBodyPart, h.NumBodyParts)
+	if err = read(r, parts); err != nil {
+		return
+	}
+
+	m.BodyParts = make([]BodyPart, len(parts))
+	for i, p := range parts {
+		if r, err = section(b, p.ModelIndex, int64(p.NumModels), 112); err != nil {
+			return
+		}
+
+		models := make([]studioModel, p.NumModels)
+		if err = read(r, models); err != nil {
+			return
+		}
+
+		part := BodyPart{
+			Name:   cString(p.Name[:]),
+			Base:   int(p.Base),
+			Models: make([]SubModel, len(models)),
+		}
+
+		for j := range models {
+			if part.Models[j], err = readSubModel(b, &models[j], h); err != nil {
+				return
+			}
+		}
+
+		m.BodyParts[i] = part
+	}
+
+	return
+}
+
+func readSubModel(b []byte, sm *studioModel, h *studioHeader) (out SubModel, err error) {
+	var r *bytes.Reader
+	out = SubModel{
+		Name:           cString(sm.Name[:]),
+		Type:           int(sm.Type),
+		BoundingRadius: float64(sm.BoundingRadius),
+	}
+
+	if out.Verts, out.VertBones, err = readPoints(b, sm.VertIndex, sm.VertInfoIndex, sm.NumVerts, h); err != nil {
+		return
+	} else if out.Normals, out.NormalBones, err = readPoints(b, sm.NormIndex, sm.NormInfoIndex, sm.NumNorms, h); err != nil {
+		return
+	}
+
+	if r, err = section(b, sm.MeshIndex, int64(sm.NumMesh), 20); err != nil {
+		return
+	}
+
+	meshes := make([]studioMesh, sm.NumMesh)
+	if err = read(r, meshes); err != nil {
+		return
+	}
+
+	out.Meshes = make([]Mesh, len(meshes))
+	for i, mesh := range meshes {
+		out.Meshes[i] = Mesh{
+			SkinRef: int(mesh.SkinRef),
+			NumTris: int(mesh.NumTris),
+		}
+
+		if out.Meshes[i].Commands, err = readTriCommands(b, mesh.TriIndex, sm); err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// readPoints reads vertices or normals along with their bone indices.
+func readPoints(b []byte, index, infoIndex, n int32, h *studioHeader) (points []Vector3, bones []int, err error) {
+	var r *bytes.Reader
+	if r, err = section(b, index, int64(n), 12); err != nil {
+		return
+	}
+
+	raw := make([][3]float32, n)
+	if err = read(r, raw); err != nil {
+		return
+	}
+
+	info := make([]uint8, len(raw))
+	if err = readItems(b, infoIndex, int64(n), 1, info); err != nil {
+		return
+	}
+
+	points = make([]Vector3, len(raw))
+	bones = make([]int, len(raw))
+	for i := range raw {
+		if int32(info[i]) >= h.NumBones {
+			err = ErrFormat
+			return
+		}
+
+		points[i] = vector3(raw[i])
+		bones[i] = int(info[i])
+	}
+
+	return
+}
+
+func readTriCommands(b []byte, offset int32, sm *studioModel) (cmds []TriCommand, err error) {
+	var r *bytes.Reader
+	if r, err = section(b, offset, 0, 0); err != nil {
+		return
+	}
+
+	for {
+		var n int16
+		if err = read(r, &n); err != nil {
+			return
+		} else if n == 0 {
+			break
+		}
+
+		cmd := TriCommand{Fan: n < 0}
+		if n < 0 {
+			n = -n
+		}
+
+		verts := make([][4]int16, n)
+		if err = read(r, verts); err != nil {
+			return
+		}
+
+		cmd.Verts = make([]TriVertex, n)
+		for i, v := range verts {
+			if v[0] < 0 || int32(v[0]) >= sm.NumVerts || v[1] < 0 || int32(v[1]) >= sm.NumNorms {
+				return nil, ErrFormat
+			}
+
+			cmd.Verts[i] = TriVertex{
+				Vert:   int(v[0]),
+				Normal: int(v[1]),
+				S:      int(v[2]),
+				T:      int(v[3]),
+			}
+		}
+
+		cmds = append(cmds, cmd)
+	}
+
+	return
+}
+
+func (m *Model) readAttachments(b []byte, h *studioHeader) (err error) {
+	var r *bytes.Reader
+	if r, err = section(b, h.AttachmentIndex, int64(h.NumAttachments), 88); err != nil {
+		return
+	}
+
+	atts := make([]studioAttachment, h.NumAttachments)
+	if err = read(r, atts); err != nil {
+		return
+	}
+
+	m.Attachments = make([]Attachment, len(atts))
+	for i, a := range atts {
+		m.Attachments[i] = Attachment{
+			Name:    cString(a.Name[:]),
+			Type:    int(a.Type),
+			Bone:    int(a.Bone),
+			Origin:  vector3(a.Origin),
+			Vectors: [3]Vector3{vector3(a.Vectors[0]), vector3(a.Vectors[1]), vector3(a.Vectors[2])},
+		}
+	}
+
+	return
+}
+
+func (m *Model) readTextures(b []byte, h *studioHeader, flags int) (err error) {
+	var r *bytes.Reader
+	if r, err = section(b, h.TextureIndex, int64(h.NumTextures), 80); err != nil {
+		return
+	}
+
+	texs := make([]studioTexture, h.NumTextures)
+	if err = read(r, texs); err != nil {
+		return
+	}
+
+	m.Textures = make([]Texture, len(texs))
+	for i, t := range texs {
+		if t.Width <= 0 || t.Height <= 0 {
+			return ErrFormat
+		}
+
+		tex := Texture{
+			Name:   cString(t.Name[:]),
+			Flags:  TextureFlags(t.Flags),
+			Width:  int(t.Width),
+			Height: int(t.Height),
+		}
+
+		if flags&NoTextures == 0 {
+			if tex.Image, err = readImage(b, t.Index, tex.Width, tex.Height, tex.Flags); err != nil {
+				return
+			}
+		}
+
+		m.Textures[i] = tex
+	}
+
+	// skin families, bounded by the data even if they have no references
+	if h.NumSkinRef < 0 || h.NumSkinFamilies < 0 || int64(h.NumSkinFamilies) > int64(len(b)) {
+		return ErrFormat
+	}
+
+	numRefs := int64(h.NumSkinRef) * int64(h.NumSkinFamilies)
+	if r, err = section(b, h.SkinIndex, numRefs, 2); err != nil {
+		return
+	}
+
+	refs := make([]int16, numRefs)
+	if err = read(r, refs); err != nil {
+		return
+	}
+
+	m.SkinFamilies = make([][]int, h.NumSkinFamilies)
+	for i := range m.SkinFamilies {
+		family := make([]int, h.NumSkinRef)
+		for j := range family {
+			ref := refs[i*int(h.NumSkinRef)+j]
+			if ref < 0 || int32(ref) >= h.NumTextures {
+				return ErrFormat
+			}
+			family[j] = int(ref)
+		}
+		m.SkinFamilies[i] = family
+	}
+
+	return
+}
+
+// readImage reads 8-bit pixels followed by a 256 colour palette.
+func readImage(b []byte, offset int32, w, h int, flags TextureFlags) (im *image.Paletted, err error) {
+	size := int64(w) * int64(h)
+	if _, err = section(b, offset, size+256*3, 1); err != nil {
+		return
+	}
+
+	pix := make([]byte, size)
+	copy(pix, b[offset:])
+
+	p := b[int64(offset)+size:]
+	palette := make(color.Palette, 256)
+	for i := range palette {
+		palette[i] = color.NRGBA{p[i*3+0], p[i*3+1], p[i*3+2], 0xff}
+	}
+
+	if flags&TextureMasked != 0 {
+		palette[255] = color.NRGBA{0, 0, 0, 0}
+	}
+
+	im = &image.Paletted{
+		Pix:     pix,
+		Stride:  w,
+		Rect:    image.Rect(0, 0, w, h),
+		Palette: palette,
+	}
+
+	return
+}
+
+func cString(b []byte) string {
+	if n := bytes.IndexByte(b, 0); n >= 0 {
+		b = b[:n]
+	}
+
+	return string(b)
+}
+
+func vector3(v [3]float32) Vector3 {
+	return Vector3{float64(v[0]), float64(v[1]), float64(v[2])}
+}
@@ -0,0 +1,288 @@
+package studio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+	"testing/fstest"
+)
+
+type builder struct {
+	bytes.Buffer
+}
+
+func (b *builder) put(v interface{}) int32 {
+	offset := int32(b.Len())
+	binary.Write(b, binary.LittleEndian, v)
+	return offset
+}
+
+// putAnim writes bone animations with the rotation Z channel of bone 1
+// animated and returns their offset.
+func putAnim(b *builder) int32 {
+	offset := b.put([2][6]uint16{{}, {5: 12}})
+	b.put([]uint8{2, 3})
+	b.put([]int16{0, 100})
+	return offset
+}
+
+func buildStudio() (main, group []byte) {
+	var b builder
+	var h studioHeader
+	b.put(h)
+
+	h.Id = [4]byte{'I', 'D', 'S', 'T'}
+	h.Version = 10
+	copy(h.Name[:], "test.mdl")
+
+	bones := []studioBone{
+		{Parent: -1, Controllers: [6]int32{-1, -1, -1, -1, -1, 0}, Scale: [6]float32{1, 1, 1, 1, 1, 1}},
+		{Parent: 0, Controllers: [6]int32{-1, -1, -1, -1, -1, -1}, Value: [6]float32{10, 0, 0}, Scale: [6]float32{1, 1, 1, 0, 0, math.Pi / 200}},
+	}
+	copy(bones[0].Name[:], "root")
+	copy(bones[1].Name[:], "arm")
+	h.NumBones, h.BoneIndex = 2, b.put(bones)
+
+	h.NumBoneControllers = 1
+	h.BoneControllerIndex = b.put(studioBoneController{Bone: 0, Type: ControlZR, Start: -90, End: 90})
+
+	h.NumHitBoxes = 1
+	h.HitBoxIndex = b.put(studioHitBox{Bone: 1, Group: 2, Max: [3]float32{1, 2, 3}})
+
+	groups := make([]studioSeqGroup, 2)
+	copy(groups[0].Label[:], "default")
+	copy(groups[1].Label[:], "group1")
+	copy(groups[1].Name[:], "models/test01.mdl")
+	h.NumSeqGroups, h.SeqGroupIndex = 2, b.put(groups)
+
+	var event studioEvent
+	event.Frame, event.Event = 1, 5004
+	copy(event.Options[:], "common/npc_step1.wav")
+	eventIndex := b.put(event)
+
+	anim := putAnim(&b)
+
+	seqs := make([]studioSeqDesc, 2)
+	copy(seqs[0].Label[:], "idle")
+	seqs[0].FPS, seqs[0].NumFrames, seqs[0].NumBlends = 10, 3, 1
+	seqs[0].NumEvents, seqs[0].EventIndex = 1, eventIndex
+	seqs[0].AnimIndex = anim
+	copy(seqs[1].Label[:], "walk")
+	seqs[1].FPS, seqs[1].NumFrames, seqs[1].NumBlends = 10, 3, 1
+	seqs[1].Flags, seqs[1].SeqGroup = SequenceLooping, 1
+	seqs[1].AnimIndex = seqHeaderLen
+	h.NumSeq, h.SeqIndex = 2, b.put(seqs)
+
+	// body part with a single triangle
+	vertIndex := b.put([][3]float32{{0, 0, 0}, {1, 0, 0}, {0, 1, 0}})
+	vertInfoIndex := b.put([]uint8{0, 1, 1})
+	normIndex := b.put([][3]float32{{0, 0, 1}})
+	normInfoIndex := b.put([]uint8{0})
+	triIndex := b.put(int16(-3))
+	b.put([][4]int16{{0, 0, 0, 0}, {1, 0, 4, 0}, {2, 0, 0, 2}})
+	b.put(int16(0))
+	meshIndex := b.put(studioMesh{NumTris: 1, TriIndex: triIndex, SkinRef: 0, NumNorms: 1})
+
+	sm := studioModel{
+		NumMesh: 1, MeshIndex: meshIndex,
+		NumVerts: 3, VertIndex: vertIndex, VertInfoIndex: vertInfoIndex,
+		NumNorms: 1, NormIndex: normIndex, NormInfoIndex: normInfoIndex,
+	}
+	copy(sm.Name[:], "body")
+	modelIndex := b.put(sm)
+
+	part := studioBodyPart{NumModels: 1, Base: 1, ModelIndex: modelIndex}
+	copy(part.Name[:], "body")
+	h.NumBodyParts, h.BodyPartIndex = 1, b.put(part)
+
+	att := studioAttachment{Bone: 1, Origin: [3]float32{0, 0, 5}}
+	copy(att.Name[:], "muzzle")
+	h.NumAttachments, h.AttachmentIndex = 1, b.put(att)
+
+	// masked 4x2 texture, two skin families
+	pixIndex := b.put([]uint8{0, 1, 2, 255, 255, 2, 1, 0})
+	palette := make([]uint8, 768)
+	palette[3] = 0xff
+	b.put(palette)
+	tex := studioTexture{Flags: uint32(TextureMasked), Width: 4, Height: 2, Index: pixIndex}
+	copy(tex.Name[:], "skin.bmp")
+	h.NumTextures, h.TextureIndex = 1, b.put(tex)
+	h.NumSkinRef, h.NumSkinFamilies, h.SkinIndex = 1, 2, b.put([]int16{0, 0})
+
+	h.Length = int32(b.Len())
+	main = b.Bytes()
+	var hb builder
+	hb.put(h)
+	copy(main, hb.Bytes())
+
+	// sequence group file
+	var g builder
+	sh := make([]byte, seqHeaderLen)
+	copy(sh, "IDSQ")
+	g.put(sh)
+	putAnim(&g)
+
+	return main, g.Bytes()
+}
+
+func TestReadSynthetic(t *testing.T) {
+	b, _ := buildStudio()
+	m, err := Read(bytes.NewReader(b), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if m.Name != "test.mdl" || len(m.Bones) != 2 || m.Bones[1].Name != "arm" || m.Bones[1].Parent != 0 {
+		t.Errorf("bad bones %+v", m.Bones)
+	}
+
+	if len(m.BoneControllers) != 1 || m.BoneControllers[0].End != 90 {
+		t.Errorf("bad controllers %+v", m.BoneControllers)
+	}
+
+	if len(m.HitBoxes) != 1 || m.HitBoxes[0].Max != (Vector3{1, 2, 3}) {
+		t.Errorf("bad hitboxes %+v", m.HitBoxes)
+	}
+
+	if len(m.SequenceGroups) != 2 || m.SequenceGroups[1].Name != "models/test01.mdl" {
+		t.Errorf("bad sequence groups %+v", m.SequenceGroups)
+	}
+
+	idle := m.Sequences[0]
+	if idle.Label != "idle" || len(idle.Events) != 1 || idle.Events[0].Options != "common/npc_step1.wav" {
+		t.Errorf("bad sequence %+v", idle)
+	}
+
+	if idle.Blends == nil || m.Sequences[1].Blends != nil {
+		t.Fatalf("sequence group 1 loaded without the file")
+	}
+
+	if ch := idle.Blends[0][1][5]; len(ch) != 3 || math.Abs(ch[2]-math.Pi/2) > 1e-6 || idle.Blends[0][1][0] != nil {
+		t.Errorf("bad animation %v", idle.Blends[0][1])
+	}
+
+	mesh := m.BodyParts[0].Models[0].Meshes[0]
+	if len(mesh.Commands) != 1 || !mesh.Commands[0].Fan || mesh.Commands[0].Verts[1] != (TriVertex{1, 0, 4, 0}) {
+		t.Errorf("bad mesh %+v", mesh)
+	}
+
+	if sm := m.BodyParts[0].Models[0]; sm.VertBones[2] != 1 || sm.Verts[1] != (Vector3{1, 0, 0}) {
+		t.Errorf("bad submodel %+v", sm)
+	}
+
+	if m.Attachments[0].Name != "muzzle" || m.Attachments[0].Bone != 1 {
+		t.Errorf("bad attachments %+v", m.Attachments)
+	}
+
+	tex := m.Textures[0]
+	if tex.Image == nil || tex.Image.ColorIndexAt(3, 0) != 255 {
+		t.Fatalf("bad texture %+v", tex)
+	}
+
+	if _, _, _, a := tex.Image.At(3, 0).RGBA(); a != 0 {
+		t.Errorf("masked pixel not transparent")
+	}
+
+	if r, _, _, _ := tex.Image.At(1, 0).RGBA(); r != 0xffff {
+		t.Errorf("bad palette")
+	}
+
+	if len(m.SkinFamilies) != 2 || m.SkinFamilies[1][0] != 0 {
+		t.Errorf("bad skin families %v", m.SkinFamilies)
+	}
+
+	if _, err = Read(bytes.NewReader(b[:len(b)-10]), 0); err != ErrFormat {
+		t.Errorf("truncated: expected ErrFormat, got %v", err)
+	}
+}
+
+// patch returns a copy of b with the item at offset read into v, changed by
+// change and written back.
+func patch(b []byte, offset int32, v interface{}, change func()) []byte {
+	out := append([]byte(nil), b...)
+	binary.Read(bytes.NewReader(out[offset:]), binary.LittleEndian, v)
+	change()
+
+	var w builder
+	w.put(v)
+	copy(out[offset:], w.Bytes())
+
+	return out
+}
+
+func TestReadMalformed(t *testing.T) {
+	b, _ := buildStudio()
+	var h studioHeader
+	binary.Read(bytes.NewReader(b), binary.LittleEndian, &h)
+	headerLen := binary.Size(h)
+
+	var (
+		tex studioTexture
+		seq studioSeqDesc
+	)
+
+	for name, mb := range map[string][]byte{
+		"bones":         patch(b[:headerLen], 0, &h, func() { h.NumBones = 0x7fffffff }),
+		"skin refs":     patch(b, 0, &h, func() { h.NumSkinRef, h.NumSkinFamilies = 0x8000, 0x10001 }),
+		"skin families": patch(b, 0, &h, func() { h.NumSkinRef, h.NumSkinFamilies = 0, 0x7fffffff }),
+		// 0x10000*0x10000 is 0 in int32
+		"texture size": patch(b, h.TextureIndex, &tex, func() { tex.Width, tex.Height = 0x10000, 0x10000 }),
+		"frames":       patch(b, h.SeqIndex, &seq, func() { seq.NumFrames = 0x7fffffff }),
+		"blends":       patch(b, h.SeqIndex, &seq, func() { seq.NumBlends = 0x7fffffff }),
+	} {
+		if _, err := Read(bytes.NewReader(mb), 0); err != ErrFormat {
+			t.Errorf("%s: expected ErrFormat, got %v", name, err)
+		}
+	}
+}
+
+func TestPose(t *testing.T) {
+	b, g := buildStudio()
+	fsys := fstest.MapFS{
+		"models/test.mdl":   {Data: b},
+		"models/test01.mdl": {Data: g},
+	}
+
+	m, err := Open(fsys, "models/test.mdl", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	near := func(a, b Vector3) bool {
+		for i := range a {
+			if math.Abs(a[i]-b[i]) > 1e-6 {
+				return false
+			}
+		}
+		return true
+	}
+
+	// arm rotates 90 degrees around Z over the first two frames
+	for _, c := range []struct {
+		seq   int
+		frame float64
+		ctl   []float64
+		want  Vector3
+	}{
+		{0, 0, []float64{0.5}, Vector3{11, 0, 0}},
+		{0, 2, []float64{0.5}, Vector3{10, 1, 0}},
+		{0, 0.5, []float64{0.5}, Vector3{10 + math.Sqrt2/2, math.Sqrt2 / 2, 0}},
+		{0, 9, []float64{0.5}, Vector3{10, 1, 0}},
+		{1, 3, []float64{0.5}, Vector3{11, 0, 0}},
+		{0, 0, []float64{1}, Vector3{0, 11, 0}},
+	} {
+		bones, err := m.Pose(c.seq, c.frame, c.ctl)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := bones[1].Transform(Vector3{1, 0, 0}); !near(got, c.want) {
+			t.Errorf("seq %d frame %v: expected %v, got %v", c.seq, c.frame, c.want, got)
+		}
+	}
+
+	if _, err = m.Pose(2, 0, nil); err == nil {
+		t.Errorf("posed a missing sequence")
+	}
+}
@@ -0,0 +1,128 @@
+/*
+Package vertexanim provides helpers shared by vertex-animated models: Quake
+alias models and Quake2 models.
+*/
+package vertexanim
+
+import (
+	"math"
+	"strings"
+)
+
+type Vector3 [3]float64
+
+// Vertex is a compressed vertex as stored in a frame.
+type Vertex struct {
+	V           [3]uint8
+	NormalIndex uint8
+}
+
+// Frame is a decoded keyframe.
+type Frame struct {
+	Name    string
+	Pos     []Vector3
+	Normals []Vector3
+}
+
+// Sequence is a run of frames sharing a name, such as "run1".."run8".
+type Sequence struct {
+	Name   string
+	Frames []int
+}
+
+// Decode scales a compressed vertex into model space.
+func (v Vertex) Decode(scale, origin Vector3) (pos, normal Vector3) {
+	for i := range pos {
+		pos[i] = float64(v.V[i])*scale[i] + origin[i]
+	}
+
+	if int(v.NormalIndex) < len(Normals) {
+		normal = Normals[v.NormalIndex]
+	}
+
+	return
+}
+
+// DecodeFrame decodes compressed vertices of a frame.
+func DecodeFrame(name string, verts []Vertex, scale, origin Vector3) (f Frame) {
+	f = Frame{
+		Name:    name,
+		Pos:     make([]Vector3, len(verts)),
+		Normals: make([]Vector3, len(verts)),
+	}
+
+	for i, v := range verts {
+		f.Pos[i], f.Normals[i] = v.Decode(scale, origin)
+	}
+
+	return
+}
+
+// Lerp interpolates between frames a and b having the same number of
+// vertices, t being 0 at a and 1 at b. Normals are renormalized. The name
+// of a is kept.
+func Lerp(a, b *Frame, t float64) (f Frame) {
+	f = Frame{
+		Name:    a.Name,
+		Pos:     make([]Vector3, len(a.Pos)),
+		Normals: make([]Vector3, len(a.Normals)),
+	}
+
+	for i := range f.Pos {
+		f.Pos[i] = lerp(a.Pos[i], b.Pos[i], t)
+	}
+
+	for i := range f.Normals {
+		n := lerp(a.Normals[i], b.Normals[i], t)
+		if l := math.Sqrt(n[0]*n[0] + n[1]*n[1] + n[2]*n[2]); l > 0 {
+			n = Vector3{n[0] / l, n[1] / l, n[2] / l}
+		}
+		f.Normals[i] = n
+	}
+
+	return
+}
+
+func lerp(a, b Vector3, t float64) Vector3 {
+	return Vector3{
+		a[0] + (b[0]-a[0])*t,
+		a[1] + (b[1]-a[1])*t,
+		a[2] + (b[2]-a[2])*t,
+	}
+}
+
+// Bounds returns the bounding box of positions.
+func Bounds(pos []Vector3) (min, max Vector3) {
+	if len(pos) == 0 {
+		return
+	}
+
+	min, max = pos[0], pos[0]
+	for _, p := range pos[1:] {
+		for i := range p {
+			min[i] = math.Min(min[i], p[i])
+			max[i] = math.Max(max[i], p[i])
+		}
+	}
+
+	return
+}
+
+// SequenceName returns a frame name with its trailing number removed.
+func SequenceName(frame string) string {
+	return strings.TrimRight(frame, "0123456789")
+}
+
+// Sequences groups consecutive frames with the same sequence name.
+func Sequences(names []string) (seqs []Sequence) {
+	for i, name := range names {
+		name = SequenceName(name)
+		if n := len(seqs); n > 0 && seqs[n-1].Name == name {
+			seqs[n-1].Frames = append(seqs[n-1].Frames, i)
+		} else {
+			seqs = append(seqs, Sequence{Name: name, Frames: []int{i}})
+		}
+	}
+
+	return
+}
@@ -0,0 +1,70 @@
+package vertexanim
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestNormals(t *testing.T) {
+	for i, n := range Normals {
+		if l := math.Sqrt(n[0]*n[0] + n[1]*n[1] + n[2]*n[2]); math.Abs(l-1) > 1e-5 {
+			t.Errorf("normal %d has length %v", i, l)
+		}
+	}
+}
+
+func TestDecodeFrame(t *testing.T) {
+	f := DecodeFrame("run1", []Vertex{{V: [3]uint8{0, 1, 2}, NormalIndex: 4}, {V: [3]uint8{255, 0, 0}, NormalIndex: 200}}, Vector3{1, 2, 0.5}, Vector3{-1, 0, 1})
+
+	if f.Name != "run1" || f.Pos[0] != (Vector3{-1, 2, 2}) || f.Pos[1] != (Vector3{254, 0, 1}) {
+		t.Errorf("bad positions %v", f.Pos)
+	}
+
+	if f.Normals[0] != Normals[4] || f.Normals[1] != (Vector3{}) {
+		t.Errorf("bad normals %v", f.Normals)
+	}
+}
+
+func TestLerp(t *testing.T) {
+	a := Frame{Name: "a", Pos: []Vector3{{0, 0, 0}}, Normals: []Vector3{{1, 0, 0}}}
+	b := Frame{Name: "b", Pos: []Vector3{{2, 4, -2}}, Normals: []Vector3{{0, 1, 0}}}
+
+	f := Lerp(&a, &b, 0.5)
+	if f.Name != "a" || f.Pos[0] != (Vector3{1, 2, -1}) {
+		t.Errorf("bad frame %+v", f)
+	}
+
+	if n := f.Normals[0]; math.Abs(n[0]-math.Sqrt2/2) > 1e-9 || math.Abs(n[1]-math.Sqrt2/2) > 1e-9 {
+		t.Errorf("normal not normalized: %v", n)
+	}
+
+	if f = Lerp(&a, &b, 1); f.Pos[0] != b.Pos[0] || f.Normals[0] != b.Normals[0] {
+		t.Errorf("bad frame at t=1 %+v", f)
+	}
+}
+
+func TestBounds(t *testing.T) {
+	min, max := Bounds([]Vector3{{1, -2, 3}, {-1, 5, 0}, {0, 0, 4}})
+	if min != (Vector3{-1, -2, 0}) || max != (Vector3{1, 5, 4}) {
+		t.Errorf("bad bounds %v %v", min, max)
+	}
+
+	if min, max = Bounds(nil); min != (Vector3{}) || max != (Vector3{}) {
+		t.Errorf("bad empty bounds %v %v", min, max)
+	}
+}
+
+func TestSequences(t *testing.T) {
+	seqs := Sequences([]string{"stand1", "stand2", "run1", "run2", "run3", "pain", "stand3"})
+	want := []Sequence{
+		{"stand", []int{0, 1}},
+		{"run", []int{2, 3, 4}},
+		{"pain", []int{5}},
+		{"stand", []int{6}},
+	}
+
+	if !reflect.DeepEqual(seqs, want) {
+		t.Errorf("expected %v, got %v", want, seqs)
+	}
+}